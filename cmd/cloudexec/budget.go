@@ -0,0 +1,57 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/crytic/cloudexec/pkg/config"
+	do "github.com/crytic/cloudexec/pkg/digitalocean"
+)
+
+// The shortest timeout we'll accept after shrinking it to fit a budget
+const minBudgetedTimeout = time.Minute
+
+// MergeBudgets combines a user-wide and a job-specific budget, keeping the stricter of each limit
+func MergeBudgets(userBudget config.Budget, jobBudget config.Budget) config.Budget {
+	stricterFloat := func(a, b float64) float64 {
+		if a == 0 || (b != 0 && b < a) {
+			return b
+		}
+		return a
+	}
+	stricterInt := func(a, b int) int {
+		if a == 0 || (b != 0 && b < a) {
+			return b
+		}
+		return a
+	}
+	return config.Budget{
+		MaxHourlyCost:         stricterFloat(userBudget.MaxHourlyCost, jobBudget.MaxHourlyCost),
+		MaxJobCost:            stricterFloat(userBudget.MaxJobCost, jobBudget.MaxJobCost),
+		MaxConcurrentDroplets: stricterInt(userBudget.MaxConcurrentDroplets, jobBudget.MaxConcurrentDroplets),
+	}
+}
+
+// EnforceBudget returns an error if launching a droplet of the given size would break the budget.
+// Otherwise, it returns the timeout shortened as needed to keep the total job cost under the cap.
+func EnforceBudget(budget config.Budget, size do.Size, timeout time.Duration, activeDroplets int) (time.Duration, error) {
+	// Refuse droplets that are too expensive no matter how long they run
+	if budget.MaxHourlyCost > 0 && size.HourlyCost > budget.MaxHourlyCost {
+		return 0, fmt.Errorf("Droplet costs $%.4f/hour which exceeds the budget of $%.4f/hour", size.HourlyCost, budget.MaxHourlyCost)
+	}
+	// Refuse to add another droplet if we're already running as many as allowed
+	if budget.MaxConcurrentDroplets > 0 && activeDroplets >= budget.MaxConcurrentDroplets {
+		return 0, fmt.Errorf("%d droplet(s) are already running which reaches the budget of %d concurrent droplet(s)", activeDroplets, budget.MaxConcurrentDroplets)
+	}
+	// Shorten the timeout so the droplet is destroyed before it costs more than the cap
+	if budget.MaxJobCost > 0 && size.HourlyCost > 0 {
+		maxRuntime := time.Duration(budget.MaxJobCost / size.HourlyCost * float64(time.Hour)).Truncate(time.Second)
+		if maxRuntime < minBudgetedTimeout {
+			return 0, fmt.Errorf("A budget of $%.4f per job only affords %v on a droplet costing $%.4f/hour", budget.MaxJobCost, maxRuntime, size.HourlyCost)
+		}
+		if maxRuntime < timeout {
+			return maxRuntime, nil
+		}
+	}
+	return timeout, nil
+}
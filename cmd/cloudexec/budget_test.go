@@ -0,0 +1,58 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/crytic/cloudexec/pkg/config"
+	do "github.com/crytic/cloudexec/pkg/digitalocean"
+)
+
+func TestMergeBudgets(t *testing.T) {
+	userBudget := config.Budget{MaxHourlyCost: 1, MaxJobCost: 50}
+	jobBudget := config.Budget{MaxJobCost: 10, MaxConcurrentDroplets: 2}
+
+	merged := MergeBudgets(userBudget, jobBudget)
+	expected := config.Budget{MaxHourlyCost: 1, MaxJobCost: 10, MaxConcurrentDroplets: 2}
+	if merged != expected {
+		t.Errorf("Expected merged budget %+v, got %+v", expected, merged)
+	}
+}
+
+func TestEnforceBudget(t *testing.T) {
+	size := do.Size{HourlyCost: 0.5}
+
+	var testTable = []struct {
+		name           string
+		budget         config.Budget
+		timeout        time.Duration
+		activeDroplets int
+		expected       time.Duration
+		expectErr      bool
+	}{
+		{"It should allow jobs without a budget", config.Budget{}, 48 * time.Hour, 5, 48 * time.Hour, false},
+		{"It should reject droplets over the hourly cap", config.Budget{MaxHourlyCost: 0.25}, time.Hour, 0, 0, true},
+		{"It should reject droplets over the concurrency cap", config.Budget{MaxConcurrentDroplets: 2}, time.Hour, 2, 0, true},
+		{"It should shorten timeouts over the job cap", config.Budget{MaxJobCost: 2}, 48 * time.Hour, 0, 4 * time.Hour, false},
+		{"It should keep timeouts under the job cap", config.Budget{MaxJobCost: 2}, time.Hour, 0, time.Hour, false},
+		{"It should reject job caps that afford almost no time", config.Budget{MaxJobCost: 0.001}, time.Hour, 0, 0, true},
+	}
+
+	for _, tt := range testTable {
+		t.Run(tt.name, func(t *testing.T) {
+			timeout, err := EnforceBudget(tt.budget, size, tt.timeout, tt.activeDroplets)
+			if tt.expectErr {
+				if err == nil {
+					t.Errorf("Expected an error but got timeout %v", timeout)
+				}
+				return
+			}
+			if err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			}
+			if timeout != tt.expected {
+				t.Errorf("Expected timeout %v, got %v", tt.expected, timeout)
+			}
+		})
+	}
+}
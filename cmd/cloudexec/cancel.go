@@ -7,30 +7,58 @@ import (
 	"github.com/crytic/cloudexec/pkg/config"
 	do "github.com/crytic/cloudexec/pkg/digitalocean"
 	"github.com/crytic/cloudexec/pkg/log"
+	"github.com/crytic/cloudexec/pkg/ssh"
 	"github.com/crytic/cloudexec/pkg/state"
 )
 
-func CancelJob(config config.Config, existingState *state.State, job *state.Job, force bool) error {
+// CancelJob destroys the droplet of a running job and marks it as cancelled. It returns false if the user
+// declined, in which case the job is still running.
+func CancelJob(config config.Config, existingState *state.State, job *state.Job, force bool) (bool, error) {
 	if job.Status != state.Provisioning && job.Status != state.Running {
 		log.Info("Job %v is not running, it is %s", job.ID, job.Status)
-    return nil
+    return true, nil
+	}
+	if job.Host != "" {
+		log.Warn("Stopping job %v on %s right away, its output will still be uploaded", job.ID, job.Host)
+	} else {
+		log.Warn("Destroying droplet %s associated with job %v: IP=%v | CreatedAt=%s", job.Droplet.Name, job.ID, job.Droplet.IP, job.Droplet.Created)
 	}
-	log.Warn("Destroying droplet %s associated with job %v: IP=%v | CreatedAt=%s", job.Droplet.Name, job.ID, job.Droplet.IP, job.Droplet.Created)
 	if !force { // Ask for confirmation before cleaning this job if no force flag
-		log.Warn("Confirm? (y/n)")
+		log.Prompt("Confirm? (y/n)")
 		var response string
 		fmt.Scanln(&response)
 		if strings.ToLower(response) != "y" {
 			log.Info("Droplet %s was not destroyed", job.Droplet.Name)
-			return nil
+			return false, nil
 		}
 	}
-	err := do.DeleteDroplet(config, job.Droplet.ID)
+	err := destroyJob(config, existingState, job)
 	if err != nil {
-		return fmt.Errorf("Failed to destroy droplet: %w", err)
+		return false, err
+	}
+	return true, nil
+}
+
+// destroyJob deletes a job's droplet straight away and marks the job as cancelled.
+// A job on an existing server has its workload killed instead, leaving the server up.
+func destroyJob(config config.Config, existingState *state.State, job *state.Job) error {
+	if job.Host != "" {
+		exitCode, err := ssh.RunCommand(JobSSHTarget(job), fmt.Sprintf("bash %s/stop.sh 0", JobRemoteDir(job)))
+		if err == nil && exitCode != 0 {
+			err = fmt.Errorf("Stop script exited with code %d", exitCode)
+		}
+		if err != nil {
+			return fmt.Errorf("Failed to stop job %v on %s: %w", job.ID, job.Host, err)
+		}
+		log.Good("Job %v stopped on %s", job.ID, job.Host)
+	} else {
+		err := do.DeleteDroplet(config, job.Droplet.ID)
+		if err != nil {
+			return fmt.Errorf("Failed to destroy droplet: %w", err)
+		}
+		log.Good("Droplet %v destroyed", job.Droplet.Name)
 	}
-	log.Good("Droplet %v destroyed", job.Droplet.Name)
-	err = existingState.CancelRunningJob(config, job.ID)
+	err := existingState.CancelRunningJob(config, job.ID)
 	if err != nil {
 		return fmt.Errorf("Failed to change job status to cancelled: %w", err)
 	}
@@ -38,24 +66,18 @@ func CancelJob(config config.Config, existingState *state.State, job *state.Job,
 	return nil
 }
 
-func CancelAll(config config.Config, existingState *state.State, force bool) error {
-	droplets, err := do.GetAllDroplets(config)
-	if err != nil {
-		return fmt.Errorf("Failed to get all running servers: %w", err)
-	}
-	if len(droplets) == 0 {
-		log.Info("No running servers found")
-		return nil
-	}
-	log.Info("Found %v running server(s):", len(droplets))
-	for _, job := range existingState.Jobs {
-		if job.Status != state.Provisioning && job.Status != state.Running {
-			continue // skip jobs that aren't running
-		}
-		err = CancelJob(config, existingState, &job, force)
+// CancelJobs cancels each of the given jobs that is still running, carrying on past failures
+func CancelJobs(config config.Config, existingState *state.State, jobs []state.Job, force bool) error {
+	failed := 0
+	for i := range jobs {
+		_, err := CancelJob(config, existingState, &jobs[i], force)
 		if err != nil {
-			log.Error("Failed to cancel job %v", job.ID)
+			log.Error("Failed to cancel job %v: %v", jobs[i].ID, err)
+			failed++
 		}
 	}
+	if failed > 0 {
+		return fmt.Errorf("Failed to cancel %d of %d job(s)", failed, len(jobs))
+	}
 	return nil
 }
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/crytic/cloudexec/pkg/config"
+	do "github.com/crytic/cloudexec/pkg/digitalocean"
+	"github.com/crytic/cloudexec/pkg/log"
+	"github.com/crytic/cloudexec/pkg/s3"
+	"github.com/crytic/cloudexec/pkg/state"
+)
+
+// How often checkpoint paths are uploaded if no interval is given
+const defaultCheckpointInterval = 30 * time.Minute
+
+// Checkpoint lists the files and directories of a job that are snapshotted to the bucket while it runs,
+// relative to the input directory, so the job can be resumed on a new droplet
+type Checkpoint struct {
+	Paths    []string `toml:"paths"`
+	Interval string   `toml:"interval"`
+}
+
+// ResumePoint is the checkpoint a resumed job starts from
+type ResumePoint struct {
+	JobID int64
+	// Seconds the run command had run for when the checkpoint was taken
+	RunTime int64
+	// Revision of the original job's input, which is reused rather than uploaded again
+	Git *state.GitInfo
+}
+
+// ParseCheckpointInterval validates the checkpoint settings of a launch config and returns how often to take one,
+// or zero if the job isn't checkpointed
+func ParseCheckpointInterval(checkpoint Checkpoint) (time.Duration, error) {
+	if len(checkpoint.Paths) == 0 {
+		if checkpoint.Interval != "" {
+			return 0, fmt.Errorf("A checkpoint interval is set but there are no checkpoint paths")
+		}
+		return 0, nil
+	}
+	for _, path := range checkpoint.Paths {
+		if path == "" || strings.ContainsAny(path, " \t\n\"'") {
+			return 0, fmt.Errorf("Invalid checkpoint path '%s', paths can't be empty or contain whitespace or quotes", path)
+		}
+		cleaned := filepath.Clean(path)
+		if filepath.IsAbs(cleaned) || cleaned == ".." || strings.HasPrefix(cleaned, "../") {
+			return 0, fmt.Errorf("Invalid checkpoint path %s, paths must be inside the input directory", path)
+		}
+	}
+	if checkpoint.Interval == "" {
+		return defaultCheckpointInterval, nil
+	}
+	interval, err := time.ParseDuration(checkpoint.Interval)
+	if err != nil {
+		return 0, fmt.Errorf("Failed to parse checkpoint interval of %s: %w", checkpoint.Interval, err)
+	}
+	if interval < time.Minute {
+		return 0, fmt.Errorf("The checkpoint interval must be at least 1m, got %s", checkpoint.Interval)
+	}
+	return interval, nil
+}
+
+// RemainingTimeout returns how much of a job's timeout is left after it has run for runTime seconds
+func RemainingTimeout(timeout string, runTime int64) (time.Duration, error) {
+	total, err := time.ParseDuration(timeout)
+	if err != nil {
+		return 0, fmt.Errorf("Failed to parse timeout of %s: %w", timeout, err)
+	}
+	return total - time.Duration(runTime)*time.Second, nil
+}
+
+func jobLaunchConfigKey(jobID int64) string {
+	return fmt.Sprintf("job-%v/launch.toml", jobID)
+}
+
+// encodeJobLaunchConfig encodes the launch config of a single job, a resumed job keeps the timeout of the
+// job it was resumed from so the time left can be worked out again if it's resumed too
+func encodeJobLaunchConfig(lc LaunchConfig) ([]byte, error) {
+	// The matrix has already been expanded into the commands
+	lc.Matrix = nil
+	if lc.Resume != nil {
+		remaining, err := time.ParseDuration(lc.Input.Timeout)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to parse timeout of %s: %w", lc.Input.Timeout, err)
+		}
+		lc.Input.Timeout = (time.Duration(lc.Resume.RunTime)*time.Second + remaining).String()
+	}
+	var buf bytes.Buffer
+	err := toml.NewEncoder(&buf).Encode(lc)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to encode launch config: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// SaveJobLaunchConfig stores the launch config a job was launched with next to its input, to resume it later
+func SaveJobLaunchConfig(config config.Config, jobID int64, lc LaunchConfig) error {
+	encoded, err := encodeJobLaunchConfig(lc)
+	if err != nil {
+		return err
+	}
+	err = s3.PutObject(config, jobLaunchConfigKey(jobID), encoded)
+	if err != nil {
+		return fmt.Errorf("Failed to save the launch config of job %v: %w", jobID, err)
+	}
+	return nil
+}
+
+// LoadJobLaunchConfig reads the launch config a job was launched with from the bucket
+func LoadJobLaunchConfig(config config.Config, jobID int64) (LaunchConfig, error) {
+	var lc LaunchConfig
+	encoded, err := s3.GetObject(config, jobLaunchConfigKey(jobID))
+	if err != nil {
+		return lc, fmt.Errorf("Failed to get the launch config of job %v, it may have been launched by an older version of cloudexec: %w", jobID, err)
+	}
+	_, err = toml.Decode(string(encoded), &lc)
+	if err != nil {
+		return lc, fmt.Errorf("Failed to decode the launch config of job %v: %w", jobID, err)
+	}
+	return lc, nil
+}
+
+// ResumeJob launches a new droplet that restores the latest checkpoint of a job that timed out, failed or was
+// stopped and continues it with the rest of its timeout, or with the given timeout if it's not zero
+func ResumeJob(config config.Config, job state.Job, serverSize string, timeout time.Duration, force bool) ([]LaunchResult, error) {
+	switch job.Status {
+	case state.Timedout, state.Failed, state.Cancelled:
+	case state.Running, state.Provisioning:
+		if job.Host != "" {
+			return nil, fmt.Errorf("Job %v is still running on %s, stop it with 'cloudexec stop' first to resume it from its final checkpoint", job.ID, job.Droplet.IP)
+		}
+		// A droplet that disappeared never got to update the job's state
+		droplets, err := do.GetAllDroplets(config)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to get running droplets: %w", err)
+		}
+		for _, droplet := range droplets {
+			if droplet.ID == job.Droplet.ID {
+				return nil, fmt.Errorf("Job %v is still running, stop it with 'cloudexec stop' first to resume it from its final checkpoint", job.ID)
+			}
+		}
+		log.Warn("The droplet of job %v no longer exists, marking the job as failed", job.ID)
+		job.Status = state.Failed
+		job.UpdatedAt = time.Now().Unix()
+		err = state.MergeAndSave(config, &state.State{Jobs: []state.Job{job}})
+		if err != nil {
+			return nil, fmt.Errorf("Failed to update S3 state: %w", err)
+		}
+	default:
+		return nil, fmt.Errorf("Job %v is %s, only jobs that timed out, failed or were stopped can be resumed", job.ID, job.Status)
+	}
+	if job.Checkpoint == nil {
+		return nil, fmt.Errorf("Job %v has no checkpoint to resume from", job.ID)
+	}
+
+	lc, err := LoadJobLaunchConfig(config, job.ID)
+	if err != nil {
+		return nil, err
+	}
+	remaining, err := RemainingTimeout(lc.Input.Timeout, job.Checkpoint.RunTime)
+	if err != nil {
+		return nil, err
+	}
+	if timeout > 0 {
+		remaining = timeout
+	}
+	if remaining <= 0 {
+		return nil, fmt.Errorf("Job %v has used up its timeout of %s, give the resumed job more time with --timeout", job.ID, lc.Input.Timeout)
+	}
+	log.Info("Resuming job %v from its checkpoint of %s with %v left to run", job.ID, time.Unix(job.Checkpoint.CreatedAt, 0).Format("2006-01-02 15:04:05"), remaining)
+
+	lc.Input.Timeout = remaining.String()
+	// The droplet's lifetime is worked out again from the time that's left
+	lc.Input.MaxLifetime = ""
+	lc.Resume = &ResumePoint{JobID: job.ID, RunTime: job.Checkpoint.RunTime, Git: job.Git}
+	lc.Project = job.Project
+	lc.ConfigName = job.ConfigName
+	lc.MatrixValues = job.Matrix
+	// The resumed job downloads the output of the same jobs again
+	lc.Dependencies = job.DependsOn
+	if serverSize == "" {
+		serverSize = job.Droplet.Size.Slug
+	}
+	if serverSize == "" {
+		serverSize = "c-2"
+	}
+	return Launch(config, serverSize, config.DigitalOcean.SpacesRegion, lc, 1, force)
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/BurntSushi/toml"
+)
+
+func TestParseCheckpointInterval(t *testing.T) {
+	interval, err := ParseCheckpointInterval(Checkpoint{})
+	if err != nil || interval != 0 {
+		t.Errorf("Jobs without checkpoint paths shouldn't be checkpointed, got %v, %v", interval, err)
+	}
+	interval, err = ParseCheckpointInterval(Checkpoint{Paths: []string{"corpus", "output/crashes"}})
+	if err != nil || interval != defaultCheckpointInterval {
+		t.Errorf("Expected the default interval, got %v, %v", interval, err)
+	}
+	interval, err = ParseCheckpointInterval(Checkpoint{Paths: []string{"corpus"}, Interval: "10m"})
+	if err != nil || interval != 10*time.Minute {
+		t.Errorf("Expected a 10m interval, got %v, %v", interval, err)
+	}
+
+	for _, checkpoint := range []Checkpoint{
+		{Interval: "10m"},
+		{Paths: []string{"corpus"}, Interval: "10s"},
+		{Paths: []string{"/root/corpus"}},
+		{Paths: []string{"../corpus"}},
+		{Paths: []string{"my corpus"}},
+		{Paths: []string{""}},
+	} {
+		if _, err := ParseCheckpointInterval(checkpoint); err == nil {
+			t.Errorf("Expected an error parsing %+v", checkpoint)
+		}
+	}
+}
+
+func TestRemainingTimeout(t *testing.T) {
+	remaining, err := RemainingTimeout("48h0m0s", 3600*10)
+	if err != nil || remaining != 38*time.Hour {
+		t.Errorf("RemainingTimeout() = %v, %v, want 38h", remaining, err)
+	}
+	if _, err := RemainingTimeout("soon", 0); err == nil {
+		t.Error("Expected an error parsing an invalid timeout")
+	}
+}
+
+func TestEncodeJobLaunchConfig(t *testing.T) {
+	lc := getLaunchConfig("10h0m0s")
+	lc.Checkpoint = Checkpoint{Paths: []string{"corpus"}}
+	lc.Matrix = map[string][]interface{}{"seed": {1, 2}}
+	lc.Resume = &ResumePoint{JobID: 3, RunTime: 3600 * 30}
+
+	encoded, err := encodeJobLaunchConfig(lc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded LaunchConfig
+	_, err = toml.Decode(string(encoded), &decoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A resumed job records the timeout of the whole chain of jobs
+	if decoded.Input.Timeout != "40h0m0s" || decoded.Commands.Run != lc.Commands.Run || decoded.Checkpoint.Paths[0] != "corpus" {
+		t.Errorf("Unexpected decoded launch config: %+v", decoded)
+	}
+	if decoded.Matrix != nil || decoded.Resume != nil {
+		t.Errorf("The matrix and resume point shouldn't be saved: %+v", decoded)
+	}
+}
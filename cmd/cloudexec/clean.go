@@ -25,7 +25,7 @@ func CleanJob(config config.Config, existingState *state.State, jobID int64, for
 	}
 	log.Warn("Removing all input, output, logs, and configuration associated with %s", prefix)
 	if !force { // Ask for confirmation before cleaning this job if no force flag
-		log.Warn("Confirm? (y/n)")
+		log.Prompt("Confirm? (y/n)")
 		var response string
 		fmt.Scanln(&response)
 		if strings.ToLower(response) != "y" {
@@ -43,6 +43,13 @@ func CleanJob(config config.Config, existingState *state.State, jobID int64, for
 		}
 	}
 	log.Good("Bucket is clean")
+	// Keep a record of this job for reporting before it's removed from the state file
+	if job := existingState.GetJob(jobID); job != nil {
+		err = state.AppendToLedger(config, *job)
+		if err != nil {
+			return fmt.Errorf("Failed to record %s in the job ledger: %w", prefix, err)
+		}
+	}
 	newState := &state.State{}
 	deleteJob := state.Job{
 		ID:     jobID,
@@ -61,16 +68,36 @@ func CleanJob(config config.Config, existingState *state.State, jobID int64, for
 	return nil
 }
 
-func CleanAll(config config.Config, existingState *state.State, force bool) error {
-	if len(existingState.Jobs) == 0 {
+// CleanJobs cancels any of the given jobs that are still running and then cleans them, carrying on past failures
+func CleanJobs(config config.Config, existingState *state.State, jobs []state.Job, force bool) error {
+	if len(jobs) == 0 {
 		log.Info("No jobs are available")
 		return nil
 	}
-	for _, job := range existingState.Jobs {
+	failed := 0
+	for i, job := range jobs {
+		// Cancel servers associated with this job if they're running
+		if job.Status == state.Provisioning || job.Status == state.Running {
+			cancelled, err := CancelJob(config, existingState, &jobs[i], force)
+			if err != nil {
+				log.Error("Failed to cancel job %v: %v", job.ID, err)
+				failed++
+				continue
+			}
+			// A job whose droplet is still up stays in the state so that it can be tracked and cancelled later
+			if !cancelled {
+				log.Info("Job %v was not cleaned since it's still running", job.ID)
+				continue
+			}
+		}
 		err := CleanJob(config, existingState, job.ID, force)
 		if err != nil {
-			log.Error("Failed to clean job %v", job.ID)
+			log.Error("Failed to clean job %v: %v", job.ID, err)
+			failed++
 		}
 	}
+	if failed > 0 {
+		return fmt.Errorf("Failed to clean %d of %d job(s)", failed, len(jobs))
+	}
 	return nil
 }
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/crytic/cloudexec/pkg/config"
+	"github.com/crytic/cloudexec/pkg/secrets"
+)
+
+// maskSetting hides a credential's value unless it's a reference to a secret rather than the secret itself
+func maskSetting(setting config.Setting) config.Setting {
+	if setting.Secret && setting.Value != "" && !secrets.IsReference(setting.Value) {
+		setting.Value = "********"
+	}
+	return setting
+}
+
+// ListConfig prints every setting of the selected profile, credentials are masked unless showSecrets is set
+func ListConfig(configFilePath string, profile string, showSecrets bool) error {
+	// Load the settings as they're written in the file, without resolving references
+	loaded, err := config.Load(configFilePath, profile)
+	if err != nil {
+		return err
+	}
+	settings := loaded.List()
+	if !showSecrets {
+		for i := range settings {
+			settings[i] = maskSetting(settings[i])
+		}
+	}
+	return PrintOutput(settings, func() error {
+		for _, setting := range settings {
+			fmt.Printf("%s = %s\n", setting.Key, setting.Value)
+		}
+		return nil
+	})
+}
+
+// GetConfig prints the value of one setting of the selected profile
+func GetConfig(configFilePath string, profile string, key string) error {
+	loaded, err := config.Load(configFilePath, profile)
+	if err != nil {
+		return err
+	}
+	setting, err := loaded.Get(key)
+	if err != nil {
+		return err
+	}
+	return PrintOutput(setting, func() error {
+		fmt.Println(setting.Value)
+		return nil
+	})
+}
+
+// SetConfig changes one setting of the selected profile, a value of '-' is read from stdin so that secrets
+// don't end up in the shell history
+func SetConfig(configFilePath string, profile string, key string, value string, stdin io.Reader) error {
+	if value == "-" {
+		line, err := bufio.NewReader(stdin).ReadString('\n')
+		if err != nil && err != io.EOF {
+			return fmt.Errorf("Failed to read value from stdin: %w", err)
+		}
+		value = strings.TrimRight(line, "\r\n")
+	}
+	return config.SetValue(configFilePath, profile, key, value)
+}
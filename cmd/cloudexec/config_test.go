@@ -0,0 +1,43 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/crytic/cloudexec/pkg/config"
+)
+
+func TestReadConfigureJSON(t *testing.T) {
+	opts := ConfigureOptions{ApiKey: "from-flag"}
+	input := `{"apiKey": "from-json", "spacesSecretKey": "op://Private/DigitalOcean/SpacesSecret", "spacesRegion": "ams3"}`
+	err := ReadConfigureJSON(strings.NewReader(input), &opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Flags take precedence over stdin
+	if opts.ApiKey != "from-flag" || opts.SpacesSecretKey != "op://Private/DigitalOcean/SpacesSecret" || opts.SpacesRegion != "ams3" || opts.Username != "" {
+		t.Errorf("Unexpected options: %+v", opts)
+	}
+
+	err = ReadConfigureJSON(strings.NewReader(`{"apikey": "x", "token": "y"}`), &opts)
+	if err == nil {
+		t.Error("Expected an error for an unknown field")
+	}
+}
+
+func TestMaskSetting(t *testing.T) {
+	tests := []struct {
+		setting config.Setting
+		want    string
+	}{
+		{config.Setting{Key: "DigitalOcean.apiKey", Value: "dop_v1_abc", Secret: true}, "********"},
+		{config.Setting{Key: "DigitalOcean.apiKey", Value: "op://Private/DigitalOcean/ApiKey", Secret: true}, "op://Private/DigitalOcean/ApiKey"},
+		{config.Setting{Key: "DigitalOcean.apiKey", Value: "", Secret: true}, ""},
+		{config.Setting{Key: "username", Value: "alice"}, "alice"},
+	}
+	for _, test := range tests {
+		if got := maskSetting(test.setting).Value; got != test.want {
+			t.Errorf("maskSetting(%s = %s) = %s, want %s", test.setting.Key, test.setting.Value, got, test.want)
+		}
+	}
+}
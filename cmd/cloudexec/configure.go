@@ -2,61 +2,129 @@ package main
 
 import (
 	"bufio"
-	"bytes"
+	"encoding/json"
 	"fmt"
+	"io"
 	"os"
-	"os/exec"
 	"os/user"
 	"strings"
 
 	"golang.org/x/term"
 
 	"github.com/crytic/cloudexec/pkg/config"
+	do "github.com/crytic/cloudexec/pkg/digitalocean"
 	"github.com/crytic/cloudexec/pkg/log"
+	"github.com/crytic/cloudexec/pkg/secrets"
 )
 
-func Configure() error {
-	user, err := user.Current()
-	if err != nil {
-		return fmt.Errorf("Failed to get current user: %v", err)
-	}
-	username, err := promptUserInput("Username", user.Username)
-	if err != nil {
-		return err
-	}
-	spacesRegion, err := promptUserInput("Digital Ocean Spaces region", "nyc3")
+// ConfigureOptions holds settings that were given to 'cloudexec configure' up front, only the missing ones are prompted for
+type ConfigureOptions struct {
+	Username        string `json:"username"`
+	ApiKey          string `json:"apiKey"`
+	SpacesAccessKey string `json:"spacesAccessKey"`
+	SpacesSecretKey string `json:"spacesSecretKey"`
+	SpacesRegion    string `json:"spacesRegion"`
+	// Fail rather than prompt for settings that weren't given
+	NonInteractive bool `json:"-"`
+	// Check the credentials with DigitalOcean before saving them
+	Validate bool `json:"-"`
+}
+
+// ReadConfigureJSON fills in the settings that weren't already given from a JSON object, eg {"apiKey": "op://..."}
+func ReadConfigureJSON(r io.Reader, opts *ConfigureOptions) error {
+	var input ConfigureOptions
+	decoder := json.NewDecoder(r)
+	decoder.DisallowUnknownFields()
+	err := decoder.Decode(&input)
 	if err != nil {
-		return err
+		return fmt.Errorf("Failed to decode settings from stdin: %w", err)
+	}
+	for _, field := range []struct{ value, input *string }{
+		{&opts.Username, &input.Username},
+		{&opts.ApiKey, &input.ApiKey},
+		{&opts.SpacesAccessKey, &input.SpacesAccessKey},
+		{&opts.SpacesSecretKey, &input.SpacesSecretKey},
+		{&opts.SpacesRegion, &input.SpacesRegion},
+	} {
+		if *field.value == "" {
+			*field.value = *field.input
+		}
 	}
-	apiKey, err := promptSecretInput("Digital Ocean API key or reference", "op://Private/DigitalOcean/ApiKey")
+	return nil
+}
+
+func Configure(opts ConfigureOptions) error {
+	user, err := user.Current()
 	if err != nil {
-		return err
+		return fmt.Errorf("Failed to get current user: %v", err)
 	}
-	spacesAccessKey, err := promptSecretInput("Digital Ocean Spaces access key ID or reference", "op://Private/DigitalOcean/SpacesKeyID")
-	if err != nil {
-		return err
+	// Without a terminal to prompt on, eg in CI, every credential has to be given up front
+	interactive := !opts.NonInteractive && term.IsTerminal(int(os.Stdin.Fd()))
+	var missing []string
+	for _, field := range []struct {
+		value        *string
+		prompt       string
+		flag         string
+		defaultValue string
+		secret       bool
+	}{
+		{&opts.Username, "Username", "username", user.Username, false},
+		{&opts.SpacesRegion, "Digital Ocean Spaces region", "spaces-region", "nyc3", false},
+		{&opts.ApiKey, "Digital Ocean API key or reference", "api-key", "op://Private/DigitalOcean/ApiKey", true},
+		{&opts.SpacesAccessKey, "Digital Ocean Spaces access key ID or reference", "spaces-access-key", "op://Private/DigitalOcean/SpacesKeyID", true},
+		{&opts.SpacesSecretKey, "Digital Ocean Spaces secret access key or reference", "spaces-secret-key", "op://Private/DigitalOcean/SpacesSecret", true},
+	} {
+		if *field.value != "" {
+			continue
+		}
+		switch {
+		case interactive && field.secret:
+			*field.value, err = promptSecretInput(field.prompt, field.defaultValue)
+		case interactive:
+			*field.value, err = promptUserInput(field.prompt, field.defaultValue)
+		case !field.secret:
+			// The username and region have sensible defaults, the credentials don't
+			*field.value = field.defaultValue
+		default:
+			missing = append(missing, "--"+field.flag)
+		}
+		if err != nil {
+			return err
+		}
 	}
-	spacesSecretKey, err := promptSecretInput("Digital Ocean Spaces secret access key or reference", "op://Private/DigitalOcean/SpacesSecret")
-	if err != nil {
-		return err
+	if len(missing) > 0 {
+		return fmt.Errorf("Missing %s, give them as flags, environment variables or JSON on stdin to configure non-interactively", strings.Join(missing, ", "))
 	}
 
 	configValues := config.Config{
-		Username: username,
+		Username: opts.Username,
 		DigitalOcean: struct {
 			ApiKey          string `toml:"apiKey"`
 			SpacesAccessKey string `toml:"spacesAccessKey"`
 			SpacesSecretKey string `toml:"spacesSecretKey"`
 			SpacesRegion    string `toml:"spacesRegion"`
 		}{
-			ApiKey:          apiKey,
-			SpacesAccessKey: spacesAccessKey,
-			SpacesSecretKey: spacesSecretKey,
-			SpacesRegion:    spacesRegion,
+			ApiKey:          opts.ApiKey,
+			SpacesAccessKey: opts.SpacesAccessKey,
+			SpacesSecretKey: opts.SpacesSecretKey,
+			SpacesRegion:    opts.SpacesRegion,
 		},
 	}
 
-	err = config.Create(configValues)
+	if opts.Validate {
+		// Check the credentials themselves, but save the references to them
+		resolved, err := resolveCredentials(configValues)
+		if err != nil {
+			return err
+		}
+		err = do.CheckAuth(resolved)
+		if err != nil {
+			return fmt.Errorf("Not saving the configuration: %w", err)
+		}
+	}
+
+	// Settings that the wizard doesn't prompt for are left as they are
+	err = config.Save(ConfigFilePath, ConfigProfile, configValues)
 	if err != nil {
 		return fmt.Errorf("failed to create configuration: %w", err)
 	}
@@ -64,12 +132,13 @@ func Configure() error {
 }
 
 func promptSecretInput(prompt, defaultValue string) (string, error) {
-	log.Info("%s [%s]: ", prompt, defaultValue)
+	log.Prompt("%s [%s]: ", prompt, defaultValue)
 	rawInput, err := term.ReadPassword(int(os.Stdin.Fd()))
 	if err != nil {
 		return "", fmt.Errorf("Failed to read input: %w", err)
 	}
-	fmt.Println()
+	// ReadPassword doesn't echo the newline so add one ourselves
+	fmt.Fprintln(os.Stderr)
 
 	input := strings.TrimSpace(string(rawInput))
 
@@ -82,7 +151,7 @@ func promptSecretInput(prompt, defaultValue string) (string, error) {
 
 func promptUserInput(prompt, defaultValue string) (string, error) {
 	reader := bufio.NewReader(os.Stdin)
-	log.Info("%s [%s]: ", prompt, defaultValue)
+	log.Prompt("%s [%s]: ", prompt, defaultValue)
 
 	input, err := reader.ReadString('\n')
 	if err != nil {
@@ -98,45 +167,28 @@ func promptUserInput(prompt, defaultValue string) (string, error) {
 	return input, nil
 }
 
-func LoadConfig(configFilePath string) (config.Config, error) {
-	config, err := config.Load(configFilePath)
+// LoadConfig loads the config file and resolves any credentials that are references to secrets
+func LoadConfig(configFilePath string, profile string) (config.Config, error) {
+	config, err := config.Load(configFilePath, profile)
 	if err != nil {
 		return config, err
 	}
-
-	value, err := processOpValue(config.DigitalOcean.ApiKey)
-	if err != nil {
-		return config, err
-	}
-	config.DigitalOcean.ApiKey = value
-
-	value, err = processOpValue(config.DigitalOcean.SpacesAccessKey)
-	if err != nil {
-		return config, err
-	}
-	config.DigitalOcean.SpacesAccessKey = value
-
-	value, err = processOpValue(config.DigitalOcean.SpacesSecretKey)
-	if err != nil {
-		return config, err
-	}
-	config.DigitalOcean.SpacesSecretKey = value
-
-	return config, nil
+	return resolveCredentials(config)
 }
 
-func processOpValue(value string) (string, error) {
-	if strings.HasPrefix(value, "op://") {
-		// Process the value using `op`
-		var stderr bytes.Buffer
-		cmd := exec.Command("op", "read", "--no-newline", value)
-		cmd.Stderr = &stderr
-		output, err := cmd.Output()
+// resolveCredentials replaces credentials that are references to secrets with the secrets themselves
+func resolveCredentials(config config.Config) (config.Config, error) {
+	for _, credential := range []*string{
+		&config.DigitalOcean.ApiKey,
+		&config.DigitalOcean.SpacesAccessKey,
+		&config.DigitalOcean.SpacesSecretKey,
+	} {
+		value, err := secrets.Resolve(*credential)
 		if err != nil {
-			// err says "exit status 1" so not very helpful, omit it from the following message
-			return "", fmt.Errorf("Failed to process 1password reference for %s: %s", value, stderr.String())
+			return config, err
 		}
-		return strings.TrimSpace(string(output)), nil
+		*credential = value
 	}
-	return value, nil
+
+	return config, nil
 }
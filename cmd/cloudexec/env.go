@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/crytic/cloudexec/pkg/secrets"
+)
+
+// Where the job's environment is written on the droplet, it's only read by the tmux session running the job
+const remoteEnvFile = "/root/.cloudexec/env"
+
+var envVarName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// ResolveSecret returns the value a secret reference points to, using any of the resolvers in the secrets package
+func ResolveSecret(name string, reference string) (string, error) {
+	if !secrets.IsReference(reference) {
+		// Don't echo the reference in case it's a secret that was pasted in directly
+		return "", fmt.Errorf("Secret %s must be a reference starting with one of %s://", name, strings.Join(secrets.Schemes(), "://, "))
+	}
+	value, err := secrets.Resolve(reference)
+	if err != nil {
+		return "", fmt.Errorf("Failed to resolve secret %s: %w", name, err)
+	}
+	return value, nil
+}
+
+// BuildEnvFile resolves the job's env vars and secrets into a file that can be sourced by bash.
+// It returns nil if the job has no env vars or secrets.
+func BuildEnvFile(lc LaunchConfig) ([]byte, error) {
+	values := make(map[string]string, len(lc.Env)+len(lc.Secrets))
+	for name, value := range lc.Env {
+		values[name] = value
+	}
+	for name, reference := range lc.Secrets {
+		if _, ok := lc.Env[name]; ok {
+			return nil, fmt.Errorf("%s is defined as both an env var and a secret", name)
+		}
+		value, err := ResolveSecret(name, reference)
+		if err != nil {
+			return nil, err
+		}
+		values[name] = value
+	}
+	if len(values) == 0 {
+		return nil, nil
+	}
+
+	names := make([]string, 0, len(values))
+	for name := range values {
+		if !envVarName.MatchString(name) {
+			return nil, fmt.Errorf("%s is not a valid environment variable name", name)
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var envFile strings.Builder
+	for _, name := range names {
+		// Single quotes keep bash from interpreting the value, quotes inside it are closed, escaped and reopened
+		fmt.Fprintf(&envFile, "%s='%s'\n", name, strings.ReplaceAll(values[name], "'", `'\''`))
+	}
+	return []byte(envFile.String()), nil
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestBuildEnvFile(t *testing.T) {
+	t.Setenv("CLOUDEXEC_TEST_TOKEN", "s3cr3t'quoted")
+	lc := LaunchConfig{
+		Env:     map[string]string{"WORKERS": "8", "GREETING": "hello $USER"},
+		Secrets: map[string]string{"TOKEN": "env://CLOUDEXEC_TEST_TOKEN"},
+	}
+	envFile, err := BuildEnvFile(lc)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := "GREETING='hello $USER'\nTOKEN='s3cr3t'\\''quoted'\nWORKERS='8'\n"
+	if string(envFile) != expected {
+		t.Errorf("Expected env file %q, got %q", expected, string(envFile))
+	}
+}
+
+func TestBuildEnvFileErrors(t *testing.T) {
+	envFile, err := BuildEnvFile(LaunchConfig{})
+	if err != nil || envFile != nil {
+		t.Errorf("Expected no env file for a job without env vars, got %q (%v)", envFile, err)
+	}
+
+	var testTable = []struct {
+		name string
+		lc   LaunchConfig
+	}{
+		{"It should reject invalid names", LaunchConfig{Env: map[string]string{"NOT-VALID": "1"}}},
+		{"It should reject unset env vars", LaunchConfig{Secrets: map[string]string{"TOKEN": "env://CLOUDEXEC_TEST_UNSET"}}},
+		{"It should reject plain secret values", LaunchConfig{Secrets: map[string]string{"TOKEN": "hunter2"}}},
+		{"It should reject duplicate names", LaunchConfig{Env: map[string]string{"TOKEN": "1"}, Secrets: map[string]string{"TOKEN": "env://HOME"}}},
+	}
+	for _, tt := range testTable {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := BuildEnvFile(tt.lc)
+			if err == nil {
+				t.Errorf("Expected an error but got none")
+			}
+		})
+	}
+}
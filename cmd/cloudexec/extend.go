@@ -0,0 +1,109 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/crytic/cloudexec/pkg/config"
+	"github.com/crytic/cloudexec/pkg/log"
+	"github.com/crytic/cloudexec/pkg/s3"
+	"github.com/crytic/cloudexec/pkg/state"
+)
+
+// JobControl is written to job-<id>/control.json in the bucket to change a running job, the droplet
+// re-reads it every minute
+type JobControl struct {
+	// Unix time at which the run command times out
+	Deadline int64 `json:"deadline,omitempty"`
+}
+
+// Formats accepted by --until, in local time unless they include a zone
+var deadlineFormats = []string{time.RFC3339, "2006-01-02 15:04:05", "2006-01-02 15:04", "2006-01-02T15:04"}
+
+// ParseDeadline parses an absolute time like '2024-01-02 15:04' or a time of day like '18:30', which is the
+// next time the clock shows that time
+func ParseDeadline(value string, now time.Time) (time.Time, error) {
+	for _, format := range deadlineFormats {
+		deadline, err := time.ParseInLocation(format, value, now.Location())
+		if err == nil {
+			return deadline, nil
+		}
+	}
+	clock, err := time.ParseInLocation("15:04", value, now.Location())
+	if err != nil {
+		return time.Time{}, fmt.Errorf("Invalid time %s, expected eg '2024-01-02 15:04', an RFC 3339 timestamp or a time of day like 18:30", value)
+	}
+	deadline := time.Date(now.Year(), now.Month(), now.Day(), clock.Hour(), clock.Minute(), 0, 0, now.Location())
+	if !deadline.After(now) {
+		deadline = deadline.AddDate(0, 0, 1)
+	}
+	return deadline, nil
+}
+
+// ParseExtension parses how far to move a deadline, eg 12h or 2d, or -30m to bring it forward
+func ParseExtension(value string) (time.Duration, error) {
+	duration, err := state.ParseAge(strings.TrimPrefix(value, "-"))
+	if err != nil {
+		return 0, fmt.Errorf("Invalid duration %s, expected eg 12h, 2d or -30m", value)
+	}
+	if strings.HasPrefix(value, "-") {
+		return -duration, nil
+	}
+	return duration, nil
+}
+
+// ExtendJob moves the deadline of a running job's run command. The new deadline is sent to the droplet through
+// the bucket, which moves its maximum lifetime by the same amount, and recorded in the job's state.
+func ExtendJob(config config.Config, job state.Job, deadline time.Time) error {
+	if job.Status != state.Provisioning && job.Status != state.Running {
+		return fmt.Errorf("Job %v is %s, only running jobs can be extended", job.ID, job.Status)
+	}
+	if !deadline.After(time.Now()) {
+		return fmt.Errorf("The new deadline %s has already passed, use 'cloudexec cancel' to stop the job now", deadline.Format("2006-01-02 15:04:05"))
+	}
+	// The job is held to the budget it was launched under, which includes the one from its launch config
+	budget := config.Budget
+	lc, err := LoadJobLaunchConfig(config, job.ID)
+	if err != nil {
+		log.Warn("Only checking the new deadline against your own budget: %v", err)
+	} else {
+		budget = MergeBudgets(config.Budget, lc.Budget)
+	}
+	// The droplet has been billed since it was created, make sure the whole job still fits in the budget
+	if budget.MaxJobCost > 0 && job.Droplet.Size.HourlyCost > 0 {
+		maxCost := deadline.Sub(time.Unix(job.StartedAt, 0)).Hours() * job.Droplet.Size.HourlyCost
+		if maxCost > budget.MaxJobCost {
+			return fmt.Errorf("Running job %v until %s would cost up to $%.2f which exceeds the budget of $%.2f per job", job.ID, deadline.Format("2006-01-02 15:04:05"), maxCost, budget.MaxJobCost)
+		}
+	}
+
+	control, err := json.Marshal(JobControl{Deadline: deadline.Unix()})
+	if err != nil {
+		return fmt.Errorf("Failed to marshal job control: %w", err)
+	}
+	err = s3.PutObject(config, fmt.Sprintf("job-%v/control.json", job.ID), control)
+	if err != nil {
+		return fmt.Errorf("Failed to update the deadline of job %v: %w", job.ID, err)
+	}
+
+	// The droplet updates the job's state as it runs, so only the deadline of its latest entry is changed.
+	// It records the deadline itself once it picks up the change, this just shows it in the status sooner.
+	currentState, err := state.GetState(config)
+	if err != nil {
+		return fmt.Errorf("Failed to record the new deadline of job %v: %w", job.ID, err)
+	}
+	currentJob := currentState.GetJob(job.ID)
+	if currentJob == nil || (currentJob.Status != state.Provisioning && currentJob.Status != state.Running) {
+		log.Warn("Job %v finished before its new deadline could be recorded", job.ID)
+		return nil
+	}
+	currentJob.Deadline = deadline.Unix()
+	err = state.MergeAndSave(config, &state.State{Jobs: []state.Job{*currentJob}})
+	if err != nil {
+		return fmt.Errorf("Failed to record the new deadline of job %v: %w", job.ID, err)
+	}
+	log.Good("Job %v will now time out at %s, the droplet will pick up the change within a minute", job.ID, deadline.Format("2006-01-02 15:04:05"))
+	return nil
+}
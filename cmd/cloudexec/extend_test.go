@@ -0,0 +1,55 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseDeadline(t *testing.T) {
+	now := time.Date(2024, 1, 2, 15, 0, 0, 0, time.UTC)
+	tests := []struct {
+		value string
+		want  time.Time
+	}{
+		{"2024-01-03 09:30", time.Date(2024, 1, 3, 9, 30, 0, 0, time.UTC)},
+		{"2024-01-03 09:30:15", time.Date(2024, 1, 3, 9, 30, 15, 0, time.UTC)},
+		{"2024-01-03T09:30:00Z", time.Date(2024, 1, 3, 9, 30, 0, 0, time.UTC)},
+		// A time of day is the next time the clock shows it
+		{"18:30", time.Date(2024, 1, 2, 18, 30, 0, 0, time.UTC)},
+		{"09:00", time.Date(2024, 1, 3, 9, 0, 0, 0, time.UTC)},
+	}
+	for _, test := range tests {
+		got, err := ParseDeadline(test.value, now)
+		if err != nil {
+			t.Errorf("ParseDeadline(%q): unexpected error: %v", test.value, err)
+			continue
+		}
+		if !got.Equal(test.want) {
+			t.Errorf("ParseDeadline(%q) = %v, want %v", test.value, got, test.want)
+		}
+	}
+	for _, value := range []string{"", "tomorrow", "25:00"} {
+		if _, err := ParseDeadline(value, now); err == nil {
+			t.Errorf("Expected an error parsing %q", value)
+		}
+	}
+}
+
+func TestParseExtension(t *testing.T) {
+	tests := map[string]time.Duration{
+		"12h":  12 * time.Hour,
+		"2d":   48 * time.Hour,
+		"-30m": -30 * time.Minute,
+	}
+	for value, want := range tests {
+		got, err := ParseExtension(value)
+		if err != nil || got != want {
+			t.Errorf("ParseExtension(%q) = %v, %v, want %v", value, got, err, want)
+		}
+	}
+	for _, value := range []string{"", "-", "later", "--1h"} {
+		if _, err := ParseExtension(value); err == nil {
+			t.Errorf("Expected an error parsing %q", value)
+		}
+	}
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"os/exec"
+	"strings"
+
+	"github.com/crytic/cloudexec/pkg/log"
+	"github.com/crytic/cloudexec/pkg/state"
+)
+
+// GetGitInfo returns the git revision of the given directory, or nil if it isn't in a git repository
+func GetGitInfo(directory string) *state.GitInfo {
+	runGit := func(args ...string) (string, error) {
+		cmd := exec.Command("git", append([]string{"-C", directory}, args...)...)
+		output, err := cmd.Output()
+		return strings.TrimSpace(string(output)), err
+	}
+	commit, err := runGit("rev-parse", "HEAD")
+	if err != nil {
+		// git isn't installed, this isn't a repository, or it has no commits yet
+		log.Debug("Not recording git info for %s: %v", directory, err)
+		return nil
+	}
+	branch, err := runGit("rev-parse", "--abbrev-ref", "HEAD")
+	if err != nil {
+		log.Debug("Failed to get the git branch of %s: %v", directory, err)
+	}
+	changes, err := runGit("status", "--porcelain")
+	if err != nil {
+		log.Debug("Failed to get the git status of %s: %v", directory, err)
+	}
+	return &state.GitInfo{
+		Commit: commit,
+		Branch: branch,
+		Dirty:  changes != "",
+	}
+}
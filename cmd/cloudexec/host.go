@@ -0,0 +1,260 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/crytic/cloudexec/pkg/config"
+	do "github.com/crytic/cloudexec/pkg/digitalocean"
+	"github.com/crytic/cloudexec/pkg/log"
+	"github.com/crytic/cloudexec/pkg/ssh"
+	"github.com/crytic/cloudexec/pkg/state"
+)
+
+// Directory in the home directory of an existing server that holds the workspace of each job run there
+const hostJobsDir = ".cloudexec/jobs"
+
+// File marking a directory as a job workspace created by cloudexec, nothing else is ever removed
+const hostWorkspaceMarker = ".cloudexec-workspace"
+
+// HostWorkspace returns the directory a job runs in on an existing server, relative to the home directory
+func HostWorkspace(jobID int64) string {
+	return fmt.Sprintf("%s/job-%v", hostJobsDir, jobID)
+}
+
+// prepareHostCommand checks that a server can run a job and creates the job's workspace, removing the
+// workspaces of earlier jobs. Only one job runs on a server at a time since they share the tmux socket.
+// It's run with bash whatever the user's login shell is.
+func prepareHostCommand(jobID int64) string {
+	script := fmt.Sprintf(`cd && for pid_file in %[1]s/*/.cloudexec/main.pid; do
+	if [ -f "$pid_file" ] && kill -0 "$(cat "$pid_file")" 2>/dev/null; then
+		echo "Another cloudexec job is still running on this server"; exit 1
+	fi
+done
+for command in bash curl jq s3cmd tmux unzip setsid; do
+	command -v "$command" >/dev/null || { echo "$command must be installed on this server to run cloudexec jobs"; exit 1; }
+done
+if [ -e %[2]s ] && [ ! -f %[2]s/%[3]s ]; then
+	echo "Refusing to replace ~/%[2]s, it wasn't created by cloudexec"; exit 1
+fi
+for workspace in %[1]s/*/; do
+	if [ -f "${workspace}%[3]s" ]; then rm -rf "$workspace"; fi
+done
+mkdir -p %[2]s/.cloudexec && touch %[2]s/%[3]s`, hostJobsDir, HostWorkspace(jobID), hostWorkspaceMarker)
+	return "bash -c '" + strings.ReplaceAll(script, "'", `'\''`) + "'"
+}
+
+// ParseHost parses the [user@]address of an existing server, the user is root by default like on droplets
+func ParseHost(host string) (string, string, error) {
+	user, address, found := strings.Cut(host, "@")
+	if !found {
+		user, address = "root", host
+	}
+	if user == "" || address == "" || strings.ContainsAny(host, " \t:/") {
+		return "", "", fmt.Errorf("Invalid host %s, expected [user@]address", host)
+	}
+	return user, address, nil
+}
+
+// JobRemoteDir returns the directory holding the job script's files on a job's server, which is relative to the
+// home directory on existing servers
+func JobRemoteDir(job *state.Job) string {
+	if job.Host != "" {
+		return HostWorkspace(job.ID) + "/.cloudexec"
+	}
+	return "/root/.cloudexec"
+}
+
+// LaunchOnHost runs a job on an existing server instead of a new droplet. The input is uploaded to the bucket and
+// the same job script as on a droplet is started over SSH, so the job is tracked, logged, attached to and pulled
+// from like any other. Nothing is created or destroyed, and the workload stops once the job is done.
+func LaunchOnHost(config config.Config, host string, lc LaunchConfig, force bool) ([]LaunchResult, error) {
+	user, address, err := ParseHost(host)
+	if err != nil {
+		return nil, err
+	}
+	if len(lc.Matrix) > 0 {
+		return nil, fmt.Errorf("The launch config has a matrix, whose jobs can't share a server. Launch them on droplets instead")
+	}
+	if lc.Resume != nil {
+		return nil, fmt.Errorf("Jobs can only be resumed on a new droplet")
+	}
+	// Resolve secrets up front so that nothing is started if one of them is missing
+	envFile, err := BuildEnvFile(lc)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to prepare the job's environment: %w", err)
+	}
+	timeouts, err := ParseTimeouts(lc.Input)
+	if err != nil {
+		return nil, err
+	}
+	policy, err := ParseRetryPolicy(lc.Input)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Info("The job will run on %s as %s for up to %v, no droplet will be created", address, user, timeouts.MaxLifetime)
+	if !force { // Ask for confirmation before launching if no force flag
+		log.Prompt("Confirm? (y/n)")
+		var response string
+		fmt.Scanln(&response)
+		if strings.ToLower(response) != "y" {
+			return nil, fmt.Errorf("Job was not launched")
+		}
+	}
+
+	existingState, err := state.GetState(config)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to get S3 state: %w", err)
+	}
+	var jobID int64 = 1
+	if latestJob := existingState.GetLatestJob(); latestJob != nil {
+		jobID = latestJob.ID + 1
+	}
+	launchedBy, hostname := launchOrigin()
+	newJob := state.Job{
+		Name:       lc.Input.JobName,
+		Project:    lc.Project,
+		ID:         jobID,
+		Status:     state.Provisioning,
+		StartedAt:  time.Now().Unix(),
+		Ports:      lc.Ports.Forward,
+		Labels:     lc.Labels,
+		Git:        GetGitInfo(lc.Input.Directory),
+		LaunchedBy: launchedBy,
+		Hostname:   hostname,
+		ConfigName: lc.ConfigName,
+		Retries:    policy.Retries,
+		DependsOn:  lc.Dependencies,
+		Host:       user + "@" + address,
+		// The server stands in for the droplet so that the job can be reached the same way
+		Droplet: do.Droplet{Name: address, IP: address},
+	}
+	err = state.MergeAndSave(config, &state.State{Jobs: []state.Job{newJob}})
+	if err != nil {
+		return nil, fmt.Errorf("Failed to update S3 state: %w", err)
+	}
+	log.Info("Registered new job with id %v", jobID)
+
+	hostKey, err := prepareHost(config, user, address, lc, &newJob, envFile != nil)
+	if err != nil {
+		abandonHostJob(config, &newJob)
+		return nil, err
+	}
+
+	// Detach the script from the SSH session so it keeps running once we disconnect
+	target := JobSSHTarget(&newJob)
+	remoteDir := JobRemoteDir(&newJob)
+	exitCode, err := ssh.RunCommand(target, fmt.Sprintf("nohup setsid bash %[1]s/job.sh >%[1]s/cloudexec.log 2>&1 </dev/null &", remoteDir))
+	if err == nil && exitCode != 0 {
+		err = fmt.Errorf("it exited with code %d", exitCode)
+	}
+	if err != nil {
+		abandonHostJob(config, &newJob)
+		return nil, fmt.Errorf("Failed to start the job script: %w", err)
+	}
+	log.Good("Job %v is running on %s", jobID, address)
+
+	// Add the server to the SSH config file for convenience, cloudexec itself doesn't rely on it
+	sshConfigErr := ssh.AddSSHConfig(target, hostKey.PublicKey, config.SSH.ForwardAgent, config.SSH.IncludeConfig)
+	if sshConfigErr != nil {
+		log.Warn("Failed to add server to SSH config file: %v", sshConfigErr)
+	} else {
+		log.Info("Added %s to SSH config", ssh.HostAlias(jobID))
+	}
+
+	// The job script waits for its environment before starting the run command, like on a droplet
+	if envFile != nil {
+		err = ssh.WriteFile(target, remoteDir+"/env", envFile, 0600)
+		if err != nil {
+			// Stop the script rather than leave it waiting, its cleanup revokes the job's key and updates the state
+			exitCode, stopErr := ssh.RunCommand(target, fmt.Sprintf("bash %s/stop.sh 0", remoteDir))
+			if stopErr == nil && exitCode != 0 {
+				stopErr = fmt.Errorf("Stop script exited with code %d", exitCode)
+			}
+			if stopErr != nil {
+				log.Error("Failed to stop job %v, cancel it with 'cloudexec cancel --job %v': %v", jobID, jobID, stopErr)
+			}
+			return nil, fmt.Errorf("Failed to send environment variables to the server: %w", err)
+		}
+		log.Info("Sent environment variables to the server of job %v", jobID)
+	}
+	if sshConfigErr == nil {
+		log.Info("SSH to your server with: %s", ssh.SSHCommand(jobID))
+	}
+	log.Info("Stream logs from the server with: cloudexec logs")
+	log.Info("Once setup is complete, you can attach to the running job with: cloudexec attach")
+
+	return []LaunchResult{{
+		JobID:       jobID,
+		DropletName: address,
+		IP:          address,
+	}}, nil
+}
+
+// abandonHostJob revokes the key of a job whose script never started on its server and marks the job as failed,
+// which the script would otherwise do once it's done
+func abandonHostJob(config config.Config, job *state.Job) {
+	if job.HostKeyFingerprint != "" {
+		err := ssh.RevokeJobKey(JobSSHTarget(job))
+		if err != nil {
+			log.Error("Failed to revoke the SSH key of job %v, remove the line ending in %s from ~/.ssh/authorized_keys on %s: %v", job.ID, ssh.HostAlias(job.ID), job.Droplet.IP, err)
+		}
+	}
+	job.Status = state.Failed
+	job.UpdatedAt = time.Now().Unix()
+	err := state.MergeAndSave(config, &state.State{Jobs: []state.Job{*job}})
+	if err != nil {
+		log.Error("Failed to mark job %v as failed: %v", job.ID, err)
+	}
+}
+
+// prepareHost uploads the input of a registered job, gives the job access to the server and uploads its script.
+// The job's pinned host key is saved to the state and the server's host key is returned.
+func prepareHost(config config.Config, user string, address string, lc LaunchConfig, newJob *state.Job, waitForEnv bool) (ssh.HostKey, error) {
+	jobID := newJob.ID
+	err := UploadDirectoryToSpaces(config, lc.Input.Directory, fmt.Sprintf("job-%v", jobID))
+	if err != nil {
+		return ssh.HostKey{}, fmt.Errorf("Failed to upload files: %w", err)
+	}
+	err = SaveJobLaunchConfig(config, jobID, lc)
+	if err != nil {
+		return ssh.HostKey{}, err
+	}
+
+	// The job gets its own key, authorized with the user's credentials and revoked by the job script once it's done
+	publicKey, err := ssh.CreateJobKeyPair(jobID)
+	if err != nil {
+		return ssh.HostKey{}, fmt.Errorf("Failed to create SSH key pair: %w", err)
+	}
+	hostKey, err := ssh.AuthorizeJobKey(user, address, jobID, publicKey)
+	if err != nil {
+		return ssh.HostKey{}, err
+	}
+	// Pin the server's host key before the job script starts updating the job's state
+	newJob.HostKeyFingerprint = hostKey.Fingerprint
+	newJob.UpdatedAt = time.Now().Unix()
+	err = state.MergeAndSave(config, &state.State{Jobs: []state.Job{*newJob}})
+	if err != nil {
+		return ssh.HostKey{}, fmt.Errorf("Failed to update S3 state: %w", err)
+	}
+	target := JobSSHTarget(newJob)
+
+	exitCode, err := ssh.RunCommand(target, prepareHostCommand(jobID))
+	if err != nil {
+		return ssh.HostKey{}, fmt.Errorf("Failed to prepare %s: %w", address, err)
+	}
+	if exitCode != 0 {
+		return ssh.HostKey{}, fmt.Errorf("Failed to prepare %s to run job %v", address, jobID)
+	}
+	script, err := GenerateHostScript(config, lc, jobID, waitForEnv)
+	if err != nil {
+		return ssh.HostKey{}, err
+	}
+	err = ssh.WriteFile(target, JobRemoteDir(newJob)+"/job.sh", []byte(script), 0700)
+	if err != nil {
+		return ssh.HostKey{}, fmt.Errorf("Failed to upload the job script: %w", err)
+	}
+	return hostKey, nil
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/crytic/cloudexec/pkg/state"
+)
+
+func TestParseHost(t *testing.T) {
+	var testTable = []struct {
+		name            string
+		host            string
+		expectedUser    string
+		expectedAddress string
+		expectErr       bool
+	}{
+		{"It should parse user@address", "ubuntu@10.0.0.5", "ubuntu", "10.0.0.5", false},
+		{"It should default to root", "fuzz.example.com", "root", "fuzz.example.com", false},
+		{"It should reject an empty user", "@10.0.0.5", "", "", true},
+		{"It should reject an empty address", "ubuntu@", "", "", true},
+		{"It should reject ports", "ubuntu@10.0.0.5:2222", "", "", true},
+	}
+	for _, tt := range testTable {
+		t.Run(tt.name, func(t *testing.T) {
+			user, address, err := ParseHost(tt.host)
+			if tt.expectErr {
+				if err == nil {
+					t.Errorf("Expected an error but got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if user != tt.expectedUser || address != tt.expectedAddress {
+				t.Errorf("Expected %s and %s, got %s and %s", tt.expectedUser, tt.expectedAddress, user, address)
+			}
+		})
+	}
+}
+
+func TestJobSSHTargetOnHost(t *testing.T) {
+	droplet := state.Job{ID: 3}
+	droplet.Droplet.IP = "10.0.0.3"
+	target := JobSSHTarget(&droplet)
+	if target.User != "root" || target.TmuxSocket != "" || target.LogFile != "" || JobRemoteDir(&droplet) != "/root/.cloudexec" {
+		t.Errorf("Unexpected target for a droplet: %+v", target)
+	}
+
+	onHost := state.Job{ID: 4, Host: "ubuntu@10.0.0.5"}
+	onHost.Droplet.IP = "10.0.0.5"
+	target = JobSSHTarget(&onHost)
+	if target.User != "ubuntu" || target.IPAddress != "10.0.0.5" || target.TmuxSocket != "cloudexec" || target.LogFile != ".cloudexec/jobs/job-4/.cloudexec/cloudexec.log" {
+		t.Errorf("Unexpected target for a job on an existing server: %+v", target)
+	}
+}
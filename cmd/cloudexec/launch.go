@@ -3,15 +3,21 @@ package main
 import (
 	"fmt"
 	"os"
+	"os/user"
 	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/BurntSushi/toml"
 	"github.com/crytic/cloudexec/pkg/config"
 	do "github.com/crytic/cloudexec/pkg/digitalocean"
 	"github.com/crytic/cloudexec/pkg/log"
+	"github.com/crytic/cloudexec/pkg/s3"
 	"github.com/crytic/cloudexec/pkg/ssh"
 	"github.com/crytic/cloudexec/pkg/state"
+	"github.com/urfave/cli/v2"
 )
 
 type Commands struct {
@@ -19,13 +25,56 @@ type Commands struct {
 	Run   string `toml:"run"`
 }
 
+// Ports lists the ports on the droplet that are forwarded to the local machine by 'cloudexec attach'
+type Ports struct {
+	Forward []string `toml:"forward"`
+}
+
+// Input describes what to upload to the droplet and how long the job may take
+type Input struct {
+	JobName   string
+	Directory string
+	// How long the run command may take
+	Timeout string
+	// How long the setup commands may take, unlimited if empty
+	SetupTimeout string
+	// How long the droplet may exist in total, including setup and uploading results
+	MaxLifetime string
+	// How long the job may go without writing any logs or output, unlimited if empty
+	IdleTimeout string
+	// How many times to retry a failed job, and for which reasons
+	Retries int
+	RetryOn []string
+}
+
 type LaunchConfig struct {
-	Commands Commands `toml:"commands"`
-	Input    struct {
-		JobName   string
-		Directory string
-		Timeout   string
-	} `toml:"input"`
+	Commands Commands      `toml:"commands"`
+	Input    Input         `toml:"input"`
+	Budget   config.Budget `toml:"budget"`
+	Ports    Ports         `toml:"ports"`
+	// Files to snapshot to the bucket while the job runs, so it can be resumed on a new droplet
+	Checkpoint Checkpoint `toml:"checkpoint"`
+	// Free-form key=value metadata recorded with the job
+	Labels map[string]string `toml:"labels"`
+	// Environment variables set for the run command, secrets are references resolved locally at launch
+	Env     map[string]string `toml:"env"`
+	Secrets map[string]string `toml:"secrets"`
+	// Names of the jobs in the same launch config whose output this job is given in deps/<name>
+	DependsOn []string `toml:"dependsOn"`
+	// Variables to sweep over, one job is launched for every combination of their values
+	Matrix map[string][]interface{} `toml:"matrix"`
+	// MatrixValues holds the matrix values of a single job once the matrix has been expanded
+	MatrixValues map[string]string `toml:"-"`
+	// ConfigName is the name of the [jobs.<name>] section defining this job, if any
+	ConfigName string `toml:"-"`
+	// Project is derived from the directory containing the launch config rather than read from it
+	Project string `toml:"-"`
+	// Resume is set when resuming a job from the checkpoint of an earlier one, whose input is reused
+	Resume *ResumePoint `toml:"-"`
+	// Dependencies maps the names in DependsOn to the jobs whose output to download
+	Dependencies map[string]int64 `toml:"-"`
+	// Pipeline is set when the job is launched as a stage of a pipeline
+	Pipeline *PipelineStage `toml:"-"`
 }
 
 func InitLaunchConfig() error {
@@ -48,6 +97,16 @@ func InitLaunchConfig() error {
 [input]
 directory = ""
 timeout = "48h"
+# Optional limits on how long setup may take, how long the droplet may exist in total
+# (by default the timeout plus 6 hours, or plus setupTimeout and 1 hour if it's set, plus any retries),
+# and how long the job may go without writing logs or output before it's stopped.
+# setupTimeout = "1h"
+# maxLifetime = "52h"
+# idleTimeout = "2h"
+# Optionally retry the job on the same droplet if it fails for one of these reasons,
+# provider errors when creating the droplet are retried with a new one.
+# retries = 2
+# retryOn = ["setup-failure", "provider-error", "exit-code:1"]
 
 [commands]
 setup = '''
@@ -60,6 +119,49 @@ setup = '''
 # This command is run from the input directory
 # after the setup script completes.
 run = ""
+
+# Optional spending limits for this job, combined with any limits in your cloudexec config.
+# The timeout will be shortened if needed to keep the job under maxJobCost.
+[budget]
+# maxHourlyCost = 0.5
+# maxJobCost = 20.0
+# maxConcurrentDroplets = 2
+
+# Optional ports to forward from the droplet while attached, as "<local>:<remote>".
+[ports]
+# forward = ["8888:8888"]
+
+# Optional labels recorded with the job, to filter 'cloudexec status' and 'cloudexec report' by.
+[labels]
+# campaign = "audit-2023-q3"
+
+# Optional environment variables for the run command.
+[env]
+# FUZZ_WORKERS = "8"
+
+# Optional secrets for the run command, resolved on this machine when launching and sent to the
+# droplet over SSH. Use 1password references (op://vault/item/field) or local env vars (env://NAME).
+[secrets]
+# GITHUB_TOKEN = "env://GITHUB_TOKEN"
+
+# Optional files or directories in the input directory to snapshot to the bucket while the job runs.
+# A job that times out or whose droplet fails can be continued from its latest checkpoint with 'cloudexec resume'.
+[checkpoint]
+# paths = ["corpus", "output"]
+# interval = "30m"
+
+# Optional variables to sweep over, one job is launched for each combination of values.
+# Refer to them in the setup and run commands as {{ matrix.<name> }}.
+[matrix]
+# seed = [1, 2, 3]
+# contract = ["Vault", "Token"]
+
+# Optional named jobs, which override the sections above. A job can depend on the output of others,
+# downloaded into deps/<name> of its input directory, and 'cloudexec pipeline run' launches them in order.
+# [jobs.build.commands]
+# run = "forge build && cp -r out output/"
+# [jobs.echidna]
+# dependsOn = ["build"]
 `)
 
 	if err != nil {
@@ -69,26 +171,279 @@ run = ""
 	return nil
 }
 
-func LoadLaunchConfig(launchConfigPath string) (LaunchConfig, error) {
-	var lc LaunchConfig
+// LaunchConfigPathFromArgs returns the launch config given by --config or as the first argument, which is
+// the cloudexec.toml in the current directory by default, along with the remaining arguments
+func LaunchConfigPathFromArgs(c *cli.Context) (string, []string, error) {
+	args := c.Args().Slice()
+	launchConfigPath := LaunchConfigFilePath
+	if c.IsSet("config") {
+		launchConfigPath = c.String("config")
+	} else if len(args) > 0 {
+		if info, err := os.Stat(args[0]); err == nil && !info.IsDir() {
+			launchConfigPath = args[0]
+			args = args[1:]
+		}
+	}
+	if _, err := os.Stat(launchConfigPath); os.IsNotExist(err) {
+		return "", nil, fmt.Errorf("please provide a path to a cloudexec.toml file or create one in the current directory")
+	}
+	return launchConfigPath, args, nil
+}
+
+// launchConfigFile is the layout of a cloudexec.toml, its top level sections are shared by all of its named jobs
+type launchConfigFile struct {
+	LaunchConfig
+	Jobs map[string]toml.Primitive `toml:"jobs"`
+}
+
+// LoadLaunchConfigs returns the launch config of each job defined in a cloudexec.toml, sorted by name.
+// A file without any [jobs.<name>] sections defines a single job with an empty config name.
+func LoadLaunchConfigs(launchConfigPath string) ([]LaunchConfig, error) {
+	var file launchConfigFile
 
 	tomlData, err := os.ReadFile(launchConfigPath)
 	if err != nil {
-		return lc, fmt.Errorf("Failed to read launch config file at %s: %w", launchConfigPath, err)
+		return nil, fmt.Errorf("Failed to read launch config file at %s: %w", launchConfigPath, err)
 	}
 
-	if _, err := toml.Decode(string(tomlData), &lc); err != nil {
-		return lc, fmt.Errorf("Failed to decode launch config file at %s: %w", launchConfigPath, err)
+	metadata, err := toml.Decode(string(tomlData), &file)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to decode launch config file at %s: %w", launchConfigPath, err)
+	}
+
+	// Group jobs into projects named after the directory containing their launch config
+	absLaunchConfigPath, err := filepath.Abs(launchConfigPath)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to resolve launch config path %s: %w", launchConfigPath, err)
+	}
+	defaults := file.LaunchConfig
+	defaults.Project = filepath.Base(filepath.Dir(absLaunchConfigPath))
+
+	if len(file.Jobs) == 0 {
+		err = validateDependencies([]LaunchConfig{defaults})
+		if err != nil {
+			return nil, fmt.Errorf("Invalid launch config file at %s: %w", launchConfigPath, err)
+		}
+		err = validateLaunchConfig(defaults)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid launch config file at %s: %w", launchConfigPath, err)
+		}
+		return []LaunchConfig{defaults}, nil
 	}
 
-	return lc, nil
+	names := make([]string, 0, len(file.Jobs))
+	for name := range file.Jobs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	lcs := make([]LaunchConfig, 0, len(names))
+	for _, name := range names {
+		// Start from a copy of the shared sections so that a job's settings only override what it sets
+		lc := defaults
+		lc.Labels = copyMap(defaults.Labels)
+		lc.Env = copyMap(defaults.Env)
+		lc.Secrets = copyMap(defaults.Secrets)
+		lc.Matrix = make(map[string][]interface{}, len(defaults.Matrix))
+		for variable, values := range defaults.Matrix {
+			lc.Matrix[variable] = values
+		}
+		err = metadata.PrimitiveDecode(file.Jobs[name], &lc)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to decode job %s in launch config file at %s: %w", name, launchConfigPath, err)
+		}
+		lc.ConfigName = name
+		if lc.Input.JobName == "" {
+			lc.Input.JobName = name
+		}
+		err = validateLaunchConfig(lc)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid job %s in launch config file at %s: %w", name, launchConfigPath, err)
+		}
+		lcs = append(lcs, lc)
+	}
+	err = validateDependencies(lcs)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid launch config file at %s: %w", launchConfigPath, err)
+	}
+	return lcs, nil
 }
 
-func Launch(config config.Config, serverSize string, serverRegion string, lc LaunchConfig) error {
+// validateLaunchConfig checks the settings of a job that can be checked before launching it
+func validateLaunchConfig(lc LaunchConfig) error {
+	_, err := ParseRetryPolicy(lc.Input)
+	if err != nil {
+		return err
+	}
+	_, err = ParseCheckpointInterval(lc.Checkpoint)
+	if err != nil {
+		return err
+	}
+	for _, spec := range lc.Ports.Forward {
+		_, err = ssh.ParsePortForward(spec)
+		if err != nil {
+			return fmt.Errorf("Invalid port forward: %w", err)
+		}
+	}
+	return nil
+}
+
+// SelectLaunchConfigs picks the named jobs to launch, or every job if all is set
+func SelectLaunchConfigs(lcs []LaunchConfig, names []string, all bool) ([]LaunchConfig, error) {
+	available := make([]string, 0, len(lcs))
+	for _, lc := range lcs {
+		available = append(available, lc.ConfigName)
+	}
+	// A file with a single unnamed job doesn't need to be told what to launch
+	if len(lcs) == 1 && lcs[0].ConfigName == "" {
+		if len(names) > 0 {
+			return nil, fmt.Errorf("The launch config doesn't define any named jobs, add [jobs.%s] sections to it to launch jobs by name", names[0])
+		}
+		return lcs, nil
+	}
+	if all {
+		if len(names) > 0 {
+			return nil, fmt.Errorf("Either give the names of jobs to launch or --all, not both")
+		}
+		return lcs, nil
+	}
+	if len(names) == 0 {
+		return nil, fmt.Errorf("The launch config defines several jobs, choose which to launch with 'cloudexec launch <name>' or launch them all with --all. Available jobs: %s", strings.Join(available, ", "))
+	}
+	selected := []LaunchConfig{}
+	for _, name := range names {
+		found := false
+		for _, lc := range lcs {
+			if lc.ConfigName == name {
+				selected = append(selected, lc)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("Job %s is not defined in the launch config. Available jobs: %s", name, strings.Join(available, ", "))
+		}
+	}
+	return selected, nil
+}
+
+func copyMap(m map[string]string) map[string]string {
+	if m == nil {
+		return nil
+	}
+	copied := make(map[string]string, len(m))
+	for k, v := range m {
+		copied[k] = v
+	}
+	return copied
+}
+
+// LaunchResult describes a newly launched job
+type LaunchResult struct {
+	JobID       int64  `json:"jobId"`
+	SweepID     int64  `json:"sweepId,omitempty"`
+	DropletName string `json:"dropletName"`
+	DropletID   int64  `json:"dropletId"`
+	IP          string `json:"ip"`
+}
+
+// Launch starts a job, or a sweep of jobs if the launch config has a matrix.
+// At most maxParallel droplets are created at once. If some jobs of a sweep fail to launch,
+// the ones that were launched are returned along with an error.
+func Launch(config config.Config, serverSize string, serverRegion string, lc LaunchConfig, maxParallel int, force bool) ([]LaunchResult, error) {
+	lcs, err := ExpandMatrix(lc)
+	if err != nil {
+		return nil, err
+	}
+	// Resolve secrets up front so that nothing is created if one of them is missing
+	envFile, err := BuildEnvFile(lc)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to prepare the job's environment: %w", err)
+	}
+	if maxParallel < 1 {
+		maxParallel = 1
+	}
+
+	// Look up the droplet size to validate it and estimate what this job will cost
+	dropletRegion := serverRegion
+	if dropletRegion == "" {
+		dropletRegion = config.DigitalOcean.SpacesRegion
+	}
+	size, err := do.GetSize(config, serverSize)
+	if err != nil {
+		return nil, err
+	}
+	if !size.AvailableIn(dropletRegion) {
+		return nil, fmt.Errorf("Droplet size %s is not available in region %s, see 'cloudexec sizes --region %s' for available sizes", serverSize, dropletRegion, dropletRegion)
+	}
+	timeouts, err := ParseTimeouts(lc.Input)
+	if err != nil {
+		return nil, err
+	}
+	policy, err := ParseRetryPolicy(lc.Input)
+	if err != nil {
+		return nil, err
+	}
+
+	// Make sure these jobs fit within the user's and the job's budget before creating anything
+	budget := MergeBudgets(config.Budget, lc.Budget)
+	if !budget.IsZero() {
+		droplets, err := do.GetAllDroplets(config)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to get running droplets: %w", err)
+		}
+		// Every job of a sweep adds another droplet
+		budgetedTimeout, err := EnforceBudget(budget, size.Size, timeouts.Timeout, len(droplets)+len(lcs)-1)
+		if err != nil {
+			return nil, fmt.Errorf("Refusing to launch job: %w", err)
+		}
+		if budgetedTimeout < timeouts.Timeout {
+			log.Warn("Shortening timeout from %v to %v to stay under the $%.2f job budget", timeouts.Timeout, budgetedTimeout, budget.MaxJobCost)
+			timeouts.Timeout = budgetedTimeout
+		}
+		// Setup is billed too, so the droplet's whole lifetime has to fit in the budget
+		budgetedLifetime, err := EnforceBudget(budget, size.Size, timeouts.MaxLifetime, len(droplets)+len(lcs)-1)
+		if err != nil {
+			return nil, fmt.Errorf("Refusing to launch job: %w", err)
+		}
+		if budgetedLifetime < timeouts.MaxLifetime {
+			log.Warn("Shortening maximum lifetime from %v to %v to stay under the $%.2f job budget", timeouts.MaxLifetime, budgetedLifetime, budget.MaxJobCost)
+			timeouts.MaxLifetime = budgetedLifetime
+		}
+	}
+	if timeouts.MaxLifetime < timeouts.SetupTimeout+timeouts.Timeout {
+		log.Warn("The maximum lifetime of %v is shorter than the setup and run timeouts combined, the job may be stopped early", timeouts.MaxLifetime)
+	}
+	// Pin the timeouts so every job of a sweep gets the same ones
+	for i := range lcs {
+		lcs[i].Input.Timeout = timeouts.Timeout.String()
+		lcs[i].Input.MaxLifetime = timeouts.MaxLifetime.String()
+	}
+
+	// Show the worst case cost of these jobs and ask for confirmation before spending anything
+	maxCost := timeouts.MaxLifetime.Hours() * size.HourlyCost
+	log.Info("A %s droplet (%d CPUs, %d MB memory, %d GB disk) costs $%.4f/hour", serverSize, size.CPUs, size.Memory, size.Disk, size.HourlyCost)
+	if len(lcs) == 1 {
+		log.Warn("This job will cost up to $%.2f if its droplet runs for the full %v maximum lifetime", maxCost, timeouts.MaxLifetime)
+	} else {
+		log.Info("The matrix expands into %d jobs:", len(lcs))
+		for _, jobConfig := range lcs {
+			log.Info("  %s", jobConfig.Input.JobName)
+		}
+		log.Warn("These jobs will cost up to $%.2f in total if their droplets all run for the full %v maximum lifetime", maxCost*float64(len(lcs)), timeouts.MaxLifetime)
+	}
+	if !force { // Ask for confirmation before launching if no force flag
+		log.Prompt("Confirm? (y/n)")
+		var response string
+		fmt.Scanln(&response)
+		if strings.ToLower(response) != "y" {
+			return nil, fmt.Errorf("Job was not launched")
+		}
+	}
+
 	// get existing state
 	existingState, err := state.GetState(config)
 	if err != nil {
-		return fmt.Errorf("Failed to get S3 state: %w", err)
+		return nil, fmt.Errorf("Failed to get S3 state: %w", err)
 	}
 	// get the latest job
 	latestJob := existingState.GetLatestJob()
@@ -98,85 +453,260 @@ func Launch(config config.Config, serverSize string, serverRegion string, lc Lau
 	} else {
 		latestJobId = latestJob.ID
 	}
-	jobID := latestJobId + 1
+	// The jobs of a sweep are grouped under the ID of the first one
+	var sweepID int64
+	if len(lcs) > 1 {
+		sweepID = latestJobId + 1
+	}
 
-	// update state struct with a new job
+	// Record where these jobs came from so they can be traced back later
+	launchedBy, hostname := launchOrigin()
+	gitInfo := GetGitInfo(lc.Input.Directory)
+	var resumedFrom int64
+	if lc.Resume != nil {
+		gitInfo = lc.Resume.Git
+		resumedFrom = lc.Resume.JobID
+	}
+	// The jobs of a pipeline are grouped under the ID of its first job
+	var pipelineID int64
+	if lc.Pipeline != nil {
+		pipelineID = lc.Pipeline.ID
+		if pipelineID == 0 {
+			pipelineID = latestJobId + 1
+		}
+	}
+
+	// Register every job up front so they're all assigned an ID before any droplet is created
 	newState := &state.State{}
 	startedAt := time.Now().Unix()
-
-	newJob := state.Job{
-		Name:      lc.Input.JobName,
-		ID:        jobID,
-		Status:    state.Provisioning,
-		StartedAt: startedAt,
+	hostKeys := make([]ssh.HostKey, len(lcs))
+	for i, jobConfig := range lcs {
+		// Generate the droplet's host key up front so we can verify its identity when connecting
+		hostKeys[i], err = ssh.GenerateHostKey()
+		if err != nil {
+			return nil, fmt.Errorf("Failed to generate SSH host key: %w", err)
+		}
+		newState.CreateJob(state.Job{
+			Name:               jobConfig.Input.JobName,
+			Project:            jobConfig.Project,
+			ID:                 latestJobId + int64(i) + 1,
+			Status:             state.Provisioning,
+			StartedAt:          startedAt,
+			HostKeyFingerprint: hostKeys[i].Fingerprint,
+			Ports:              jobConfig.Ports.Forward,
+			Labels:             jobConfig.Labels,
+			Git:                gitInfo,
+			LaunchedBy:         launchedBy,
+			Hostname:           hostname,
+			SweepID:            sweepID,
+			Matrix:             jobConfig.MatrixValues,
+			ConfigName:         jobConfig.ConfigName,
+			Retries:            policy.Retries,
+			ResumedFrom:        resumedFrom,
+			PipelineID:         pipelineID,
+			DependsOn:          jobConfig.Dependencies,
+		})
 	}
-	newState.CreateJob(newJob)
 	// sync state to bucket
 	err = state.MergeAndSave(config, newState)
-	log.Info("Registered new job with id %v", jobID)
 	if err != nil {
-		return fmt.Errorf("Failed to update S3 state: %w", err)
+		return nil, fmt.Errorf("Failed to update S3 state: %w", err)
+	}
+	if sweepID != 0 {
+		log.Info("Registered sweep %v with jobs %v to %v", sweepID, newState.Jobs[0].ID, newState.Jobs[len(newState.Jobs)-1].ID)
+	} else {
+		log.Info("Registered new job with id %v", newState.Jobs[0].ID)
 	}
 
-	// upload local files to the bucket
-	sourcePath := lc.Input.Directory // TODO: verify that this path exists & throw informative error if not
-	destPath := fmt.Sprintf("job-%v", jobID)
-	err = UploadDirectoryToSpaces(config, sourcePath, destPath)
+	// Create the droplets, a few at a time
+	results := make([]*LaunchResult, len(lcs))
+	errs := make([]error, len(lcs))
+	slots := make(chan struct{}, maxParallel)
+	var wg sync.WaitGroup
+	for i := range lcs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			slots <- struct{}{}
+			defer func() { <-slots }()
+			results[i], errs[i] = provisionJob(config, serverSize, dropletRegion, lcs[i], newState.Jobs[i], hostKeys[i], envFile)
+		}(i)
+	}
+	wg.Wait()
+
+	launched := []LaunchResult{}
+	var lastErr error
+	for i, result := range results {
+		if errs[i] != nil {
+			log.Error("Failed to launch job %v: %v", newState.Jobs[i].ID, errs[i])
+			lastErr = errs[i]
+			continue
+		}
+		result.SweepID = sweepID
+		launched = append(launched, *result)
+	}
+	if len(lcs) == 1 {
+		if lastErr != nil {
+			return nil, lastErr
+		}
+		log.Info("Stream logs from the server with: cloudexec logs")
+		log.Info("Once setup is complete, you can attach to the running job with: cloudexec attach")
+		return launched, nil
+	}
+	log.Info("Check on the sweep with: cloudexec status --sweep %v", sweepID)
+	log.Info("Once the jobs are done, pull all of their results with: cloudexec pull --sweep %v", sweepID)
+	if lastErr != nil {
+		return launched, fmt.Errorf("Failed to launch %d of %d jobs in sweep %v", len(lcs)-len(launched), len(lcs), sweepID)
+	}
+	return launched, nil
+}
+
+// launchOrigin returns the local user and machine jobs are launched from
+func launchOrigin() (launchedBy string, hostname string) {
+	if currentUser, err := user.Current(); err == nil {
+		launchedBy = currentUser.Username
+	}
+	hostname, err := os.Hostname()
 	if err != nil {
-		return fmt.Errorf("Failed to upload files: %w", err)
+		log.Debug("Failed to get hostname: %v", err)
 	}
+	return launchedBy, hostname
+}
+
+// provisionJob uploads the input of a registered job and creates its droplet
+func provisionJob(config config.Config, serverSize string, dropletRegion string, lc LaunchConfig, newJob state.Job, hostKey ssh.HostKey, envFile []byte) (*LaunchResult, error) {
+	jobID := newJob.ID
 
-	// Get or create an SSH key
-	publicKey, err := ssh.GetOrCreateSSHKeyPair()
+	destPath := fmt.Sprintf("job-%v", jobID)
+	if lc.Resume != nil {
+		// Reuse the input of the job being resumed, the local copy may have changed since
+		err := s3.CopyObject(config, fmt.Sprintf("job-%v/input.zip", lc.Resume.JobID), destPath+"/input.zip")
+		if err != nil {
+			return nil, fmt.Errorf("Failed to copy the input of job %v: %w", lc.Resume.JobID, err)
+		}
+	} else {
+		// upload local files to the bucket
+		sourcePath := lc.Input.Directory // TODO: verify that this path exists & throw informative error if not
+		err := UploadDirectoryToSpaces(config, sourcePath, destPath)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to upload files: %w", err)
+		}
+	}
+	err := SaveJobLaunchConfig(config, jobID, lc)
 	if err != nil {
-		return fmt.Errorf("Failed to get or creating SSH key pair: %w", err)
+		return nil, err
 	}
 
-	// Prepare user data
-	userData, err := GenerateUserData(config, lc)
+	// Create an SSH key that only grants access to this job's droplet
+	publicKey, err := ssh.CreateJobKeyPair(jobID)
 	if err != nil {
-		return fmt.Errorf("Failed to generate user data: %w", err)
+		return nil, fmt.Errorf("Failed to create SSH key pair: %w", err)
 	}
 
-	log.Wait("Creating new %s server in %s for job %d", serverSize, config.DigitalOcean.SpacesRegion, jobID)
-	server, err := do.CreateDroplet(config, config.DigitalOcean.SpacesRegion, serverSize, userData, jobID, publicKey)
+	// Provider errors while creating the droplet or waiting for it are retried with a new droplet if allowed
+	policy, err := ParseRetryPolicy(lc.Input)
 	if err != nil {
-		return fmt.Errorf("Failed to create server: %w", err)
+		return nil, err
+	}
+	attempt := 1
+	attemptStartedAt := newJob.StartedAt
+	var server do.Droplet
+	for {
+		server, err = createJobDroplet(config, serverSize, dropletRegion, lc, &newJob, hostKey, publicKey, envFile != nil, attempt)
+		if err == nil {
+			break
+		}
+		if !policy.RetriesOn(RetryProviderError) || attempt > policy.Retries {
+			return nil, err
+		}
+		log.Warn("Attempt %d of job %v failed, retrying with a new droplet: %v", attempt, jobID, err)
+		if server.ID != 0 {
+			deleteErr := do.DeleteDroplet(config, server.ID)
+			if deleteErr != nil {
+				log.Error("Failed to destroy droplet %s of the failed attempt, destroy it from the DigitalOcean dashboard: %v", server.Name, deleteErr)
+			}
+		}
+		// The uploaded input is reused, the job keeps its ID and records the failed attempt
+		now := time.Now().Unix()
+		newJob.Attempts = append(newJob.Attempts, state.Attempt{
+			Number:    attempt,
+			Reason:    RetryProviderError,
+			StartedAt: attemptStartedAt,
+			EndedAt:   now,
+		})
+		attempt++
+		attemptStartedAt = now
+		newJob.Attempt = attempt
+		newJob.Droplet = do.Droplet{}
+		newJob.UpdatedAt = now
+		err = state.MergeAndSave(config, &state.State{Jobs: []state.Job{newJob}})
+		if err != nil {
+			return nil, fmt.Errorf("Failed to update S3 state: %w", err)
+		}
 	}
-	log.Good("Server created with IP: %v", server.IP)
+	log.Good("Good Morning! Job %v is up", jobID)
 
-	// Add the server info to state
-	updatedAt := time.Now().Unix()
-	for i, job := range newState.Jobs {
-		if job.ID == jobID {
-			newState.Jobs[i].Droplet = server
-			newState.Jobs[i].UpdatedAt = updatedAt
+	// Add the server to the SSH config file for convenience, cloudexec itself doesn't rely on it
+	sshConfigErr := ssh.AddSSHConfig(JobSSHTarget(&newJob), hostKey.PublicKey, config.SSH.ForwardAgent, config.SSH.IncludeConfig)
+	if sshConfigErr != nil {
+		log.Warn("Failed to add server to SSH config file: %v", sshConfigErr)
+	} else {
+		log.Info("Added %s to SSH config", ssh.HostAlias(jobID))
+	}
+
+	// The droplet waits for its environment before starting the run command.
+	// It's sent over SSH so that secrets never end up in the user data or in the bucket.
+	if envFile != nil {
+		err = ssh.WriteFile(JobSSHTarget(&newJob), remoteEnvFile, envFile, 0600)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to send environment variables to the server: %w", err)
 		}
+		log.Info("Sent environment variables to the server of job %v", jobID)
 	}
-	err = state.MergeAndSave(config, newState)
+	if sshConfigErr == nil {
+		log.Info("SSH to your server with: %s", ssh.SSHCommand(jobID))
+	}
+
+	return &LaunchResult{
+		JobID:       jobID,
+		DropletName: server.Name,
+		DropletID:   server.ID,
+		IP:          server.IP,
+	}, nil
+}
+
+// createJobDroplet creates the droplet for an attempt at a job, records it in the job's state and waits until
+// it can be reached over SSH. The droplet is returned along with the error if it was created but is unreachable.
+func createJobDroplet(config config.Config, serverSize string, dropletRegion string, lc LaunchConfig, newJob *state.Job, hostKey ssh.HostKey, publicKey string, waitForEnv bool, attempt int) (do.Droplet, error) {
+	jobID := newJob.ID
+
+	// Prepare user data
+	userData, err := GenerateUserData(config, lc, hostKey, waitForEnv, attempt)
 	if err != nil {
-		return fmt.Errorf("Failed to update S3 state: %w", err)
+		return do.Droplet{}, fmt.Errorf("Failed to generate user data: %w", err)
 	}
-	log.Info("Saved new server info to state")
 
-	// Add the server to the SSH config file
-	err = ssh.AddSSHConfig(jobID, server.IP)
+	log.Wait("Creating new %s server in %s for job %d", serverSize, dropletRegion, jobID)
+	server, err := do.CreateDroplet(config, dropletRegion, serverSize, userData, jobID, publicKey)
 	if err != nil {
-		return fmt.Errorf("Failed to add server to SSH config file: %w", err)
+		return do.Droplet{}, fmt.Errorf("Failed to create server: %w", err)
 	}
-	log.Info("Added cloudexec-%v to SSH config", jobID)
+	log.Good("Server for job %v created with IP: %v", jobID, server.IP)
 
-	// Ensure we can SSH into the server
-	log.Wait("Waiting for our new server to wake up")
-	err = ssh.WaitForSSHConnection(jobID)
+	// Add the server info to state
+	newJob.Droplet = server
+	newJob.UpdatedAt = time.Now().Unix()
+	err = state.MergeAndSave(config, &state.State{Jobs: []state.Job{*newJob}})
 	if err != nil {
-		return fmt.Errorf("Failed to SSH into the server: %w", err)
+		return server, fmt.Errorf("Failed to update S3 state: %w", err)
 	}
-	log.Good("Good Morning!")
-	fmt.Println()
-	log.Info("Stream logs from the server with: cloudexec logs")
-	log.Info("SSH to your server with: ssh cloudexec-%v", jobID)
-	log.Info("Once setup is complete, you can attach to the running job with: cloudexec attach")
+	log.Info("Saved new server info for job %v to state", jobID)
 
-	return nil
+	// Ensure we can SSH into the server
+	log.Wait("Waiting for the server of job %v to wake up", jobID)
+	err = ssh.WaitForSSHConnection(JobSSHTarget(newJob))
+	if err != nil {
+		return server, fmt.Errorf("Failed to SSH into the server: %w", err)
+	}
+	return server, nil
 }
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadLaunchConfigsWithNamedJobs(t *testing.T) {
+	launchConfigPath := filepath.Join(t.TempDir(), "cloudexec.toml")
+	err := os.WriteFile(launchConfigPath, []byte(`
+[input]
+directory = "input"
+timeout = "48h"
+
+[commands]
+setup = "install-tools"
+
+[labels]
+campaign = "q3"
+
+[jobs.echidna.commands]
+run = "echidna ."
+
+[jobs.medusa]
+labels = { fuzzer = "medusa" }
+input = { jobName = "medusa fuzzing", timeout = "12h" }
+commands = { run = "medusa fuzz" }
+`), 0644)
+	if err != nil {
+		t.Fatalf("Failed to write launch config: %v", err)
+	}
+
+	lcs, err := LoadLaunchConfigs(launchConfigPath)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(lcs) != 2 {
+		t.Fatalf("Expected 2 jobs, got %d", len(lcs))
+	}
+	echidna, medusa := lcs[0], lcs[1]
+	if echidna.ConfigName != "echidna" || echidna.Input.JobName != "echidna" || echidna.Input.Timeout != "48h" {
+		t.Errorf("Expected echidna to use the shared input, got %+v", echidna.Input)
+	}
+	if echidna.Commands.Setup != "install-tools" || echidna.Commands.Run != "echidna ." {
+		t.Errorf("Unexpected echidna commands %+v", echidna.Commands)
+	}
+	if medusa.Input.JobName != "medusa fuzzing" || medusa.Input.Timeout != "12h" || medusa.Input.Directory != "input" {
+		t.Errorf("Expected medusa to override part of the shared input, got %+v", medusa.Input)
+	}
+	if medusa.Labels["campaign"] != "q3" || medusa.Labels["fuzzer"] != "medusa" || echidna.Labels["fuzzer"] != "" {
+		t.Errorf("Unexpected labels: echidna %v, medusa %v", echidna.Labels, medusa.Labels)
+	}
+
+	selected, err := SelectLaunchConfigs(lcs, []string{"medusa"}, false)
+	if err != nil || len(selected) != 1 || selected[0].ConfigName != "medusa" {
+		t.Errorf("Expected to select medusa, got %v (%v)", selected, err)
+	}
+	selected, err = SelectLaunchConfigs(lcs, nil, true)
+	if err != nil || len(selected) != 2 {
+		t.Errorf("Expected to select both jobs, got %v (%v)", selected, err)
+	}
+	if _, err = SelectLaunchConfigs(lcs, nil, false); err == nil {
+		t.Errorf("Expected an error when no job is chosen")
+	}
+	if _, err = SelectLaunchConfigs(lcs, []string{"slither"}, false); err == nil {
+		t.Errorf("Expected an error for an unknown job")
+	}
+}
+
+func TestLoadLaunchConfigsWithSingleJob(t *testing.T) {
+	launchConfigPath := filepath.Join(t.TempDir(), "cloudexec.toml")
+	err := os.WriteFile(launchConfigPath, []byte(`
+[input]
+jobName = "fuzz"
+timeout = "1h"
+
+[commands]
+run = "medusa fuzz"
+`), 0644)
+	if err != nil {
+		t.Fatalf("Failed to write launch config: %v", err)
+	}
+
+	lcs, err := LoadLaunchConfigs(launchConfigPath)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	selected, err := SelectLaunchConfigs(lcs, nil, false)
+	if err != nil || len(selected) != 1 || selected[0].ConfigName != "" || selected[0].Input.JobName != "fuzz" {
+		t.Errorf("Expected the single job to be selected, got %v (%v)", selected, err)
+	}
+	if _, err = SelectLaunchConfigs(lcs, []string{"fuzz"}, false); err == nil {
+		t.Errorf("Expected an error when naming a job in a file without named jobs")
+	}
+}
@@ -1,11 +1,14 @@
 package main
 
 import (
-	"encoding/json"
 	"fmt"
 	"os"
+	"path/filepath"
 	"strconv"
+	"strings"
+	"time"
 
+	"github.com/crytic/cloudexec/pkg/config"
 	do "github.com/crytic/cloudexec/pkg/digitalocean"
 	"github.com/crytic/cloudexec/pkg/log"
 	"github.com/crytic/cloudexec/pkg/ssh"
@@ -17,7 +20,8 @@ var (
 	Version              = "dev"
 	Commit               = "none"
 	Date                 = "unknown"
-	ConfigFilePath       = fmt.Sprintf("%s/.config/cloudexec/config.toml", os.Getenv("HOME"))
+	ConfigFilePath       = config.DefaultPath()
+	ConfigProfile        = ""
 	LaunchConfigFilePath = "./cloudexec.toml"
 )
 
@@ -25,6 +29,74 @@ func main() {
 	app := &cli.App{
 		Name:  "cloudexec",
 		Usage: "easily run cloud based jobs",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:    "output",
+				Aliases: []string{"o"},
+				Value:   TableOutput,
+				Usage:   "Format of command results printed to stdout, one of table, json, yaml",
+			},
+			&cli.BoolFlag{
+				Name:    "verbose",
+				EnvVars: []string{"CLOUDEXEC_VERBOSE"},
+				Usage:   "Log debug messages, including calls to DigitalOcean and Spaces",
+			},
+			&cli.BoolFlag{
+				Name:    "quiet",
+				Aliases: []string{"q"},
+				Usage:   "Only log warnings and errors",
+			},
+			&cli.StringFlag{
+				Name:        "config",
+				EnvVars:     []string{"CLOUDEXEC_CONFIG"},
+				DefaultText: "$XDG_CONFIG_HOME/cloudexec/config.toml or ~/.config/cloudexec/config.toml",
+				Usage:       "Path to the cloudexec config file",
+			},
+			&cli.StringFlag{
+				Name:    "profile",
+				Aliases: []string{"p"},
+				EnvVars: []string{"CLOUDEXEC_PROFILE"},
+				Usage:   "Use the account and settings of a named profile from the config file",
+			},
+			&cli.StringFlag{
+				Name:    "log-format",
+				Value:   string(log.TextFormat),
+				EnvVars: []string{"CLOUDEXEC_LOG_FORMAT"},
+				Usage:   "Format of log messages written to stderr, one of text, json",
+			},
+		},
+		Before: func(c *cli.Context) error {
+			OutputFormat = c.String("output")
+			err := ValidateOutputFormat(OutputFormat)
+			if err != nil {
+				return err
+			}
+			err = log.SetFormat(log.Format(c.String("log-format")))
+			if err != nil {
+				return err
+			}
+			if c.Bool("verbose") && c.Bool("quiet") {
+				return fmt.Errorf("The --verbose and --quiet flags can't be used together")
+			}
+			if c.Bool("verbose") {
+				log.SetLevel(log.DebugLevel)
+			} else if c.Bool("quiet") {
+				log.SetLevel(log.WarnLevel)
+			}
+			if c.String("config") != "" {
+				ConfigFilePath = c.String("config")
+			}
+			ConfigProfile = c.String("profile")
+			if ConfigProfile != "" {
+				err = config.ValidateProfileName(ConfigProfile)
+				if err != nil {
+					return err
+				}
+			}
+			// Jobs of different profiles can have the same ID so they're kept apart in the SSH config
+			ssh.SetProfile(ConfigProfile)
+			return nil
+		},
 		Commands: []*cli.Command{
 
 			{
@@ -32,16 +104,79 @@ func main() {
 				Usage:   "Gets the version of the app",
 				Aliases: []string{"v"},
 				Action: func(*cli.Context) error {
-					log.Info("cloudexec %s, commit %s, built at %s", Version, Commit, Date)
-					return nil
+					versionInfo := map[string]string{
+						"version": Version,
+						"commit":  Commit,
+						"date":    Date,
+					}
+					return PrintOutput(versionInfo, func() error {
+						fmt.Printf("cloudexec %s, commit %s, built at %s\n", Version, Commit, Date)
+						return nil
+					})
 				},
 			},
 
 			{
 				Name:  "configure",
 				Usage: "Configure credentials",
-				Action: func(*cli.Context) error {
-					err := Configure()
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:    "username",
+						EnvVars: []string{"CLOUDEXEC_USERNAME"},
+						Usage:   "Username, which selects your Spaces bucket (default: your local username)",
+					},
+					&cli.StringFlag{
+						Name:    "api-key",
+						EnvVars: []string{"DIGITALOCEAN_API_KEY"},
+						Usage:   "DigitalOcean API key or a reference to it",
+					},
+					&cli.StringFlag{
+						Name:    "spaces-access-key",
+						EnvVars: []string{"DIGITALOCEAN_SPACES_ACCESS_KEY"},
+						Usage:   "DigitalOcean Spaces access key ID or a reference to it",
+					},
+					&cli.StringFlag{
+						Name:    "spaces-secret-key",
+						EnvVars: []string{"DIGITALOCEAN_SPACES_SECRET_ACCESS_KEY"},
+						Usage:   "DigitalOcean Spaces secret access key or a reference to it",
+					},
+					&cli.StringFlag{
+						Name:    "spaces-region",
+						EnvVars: []string{"DIGITALOCEAN_SPACES_REGION"},
+						Usage:   "DigitalOcean Spaces region (default: nyc3)",
+					},
+					&cli.BoolFlag{
+						Name:  "from-stdin",
+						Usage: "Read settings as a JSON object from stdin, eg {\"apiKey\": \"...\"}, flags take precedence",
+					},
+					&cli.BoolFlag{
+						Name:  "non-interactive",
+						Usage: "Fail instead of prompting for settings that weren't given, implied when stdin isn't a terminal",
+					},
+					&cli.BoolFlag{
+						Name:  "validate",
+						Usage: "Check the credentials with DigitalOcean before saving them",
+					},
+				},
+				Action: func(c *cli.Context) error {
+					opts := ConfigureOptions{
+						Username:        c.String("username"),
+						ApiKey:          c.String("api-key"),
+						SpacesAccessKey: c.String("spaces-access-key"),
+						SpacesSecretKey: c.String("spaces-secret-key"),
+						SpacesRegion:    c.String("spaces-region"),
+						NonInteractive:  c.Bool("non-interactive"),
+						Validate:        c.Bool("validate"),
+					}
+					if c.Bool("from-stdin") {
+						err := ReadConfigureJSON(os.Stdin, &opts)
+						if err != nil {
+							return err
+						}
+						// Stdin has been used up so there's nothing left to prompt with
+						opts.NonInteractive = true
+					}
+					err := Configure(opts)
 					if err != nil {
 						return err
 					}
@@ -49,6 +184,51 @@ func main() {
 				},
 			},
 
+			{
+				Name:  "config",
+				Usage: "Read or change individual settings in the config file",
+				Subcommands: []*cli.Command{
+
+					{
+						Name:  "list",
+						Usage: "List the settings of the selected profile, including any from environment variables",
+						Flags: []cli.Flag{
+							&cli.BoolFlag{
+								Name:  "show-secrets",
+								Usage: "Print credentials instead of masking them",
+							},
+						},
+						Action: func(c *cli.Context) error {
+							return ListConfig(ConfigFilePath, ConfigProfile, c.Bool("show-secrets"))
+						},
+					},
+
+					{
+						Name:      "get",
+						Usage:     "Print the value of a setting, eg Budget.maxJobCost",
+						ArgsUsage: "<key>",
+						Action: func(c *cli.Context) error {
+							if c.NArg() != 1 {
+								return fmt.Errorf("Expected a setting, usage: cloudexec config get <key>")
+							}
+							return GetConfig(ConfigFilePath, ConfigProfile, c.Args().First())
+						},
+					},
+
+					{
+						Name:      "set",
+						Usage:     "Change a setting, a value of '-' is read from stdin",
+						ArgsUsage: "<key> <value>",
+						Action: func(c *cli.Context) error {
+							if c.NArg() != 2 {
+								return fmt.Errorf("Expected a setting and a value, usage: cloudexec config set <key> <value>")
+							}
+							return SetConfig(ConfigFilePath, ConfigProfile, c.Args().Get(0), c.Args().Get(1), os.Stdin)
+						},
+					},
+				},
+			},
+
 			{
 				Name:  "init",
 				Usage: "Create a new cloudexec.toml launch configuration in the current directory",
@@ -66,7 +246,7 @@ func main() {
 				Usage:   "Verifies cloud authentication",
 				Aliases: []string{"c"},
 				Action: func(*cli.Context) error {
-					config, configErr := LoadConfig(ConfigFilePath)
+					config, configErr := LoadConfig(ConfigFilePath, ConfigProfile)
 					if configErr != nil {
 						return configErr
 					}
@@ -84,13 +264,36 @@ func main() {
 			},
 
 			{
-				Name:    "launch",
-				Usage:   "Launch a droplet and start a job",
-				Aliases: []string{"l"},
+				Name:  "sizes",
+				Usage: "List the droplet sizes available to launch and their prices",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "region",
+						Usage: "Only show sizes available in this region",
+					},
+				},
+				Action: func(c *cli.Context) error {
+					config, configErr := LoadConfig(ConfigFilePath, ConfigProfile)
+					if configErr != nil {
+						return configErr
+					}
+					return PrintSizes(config, c.String("region"))
+				},
+			},
+
+			{
+				Name:      "launch",
+				Usage:     "Launch a droplet and start a job",
+				ArgsUsage: "[job names...]",
+				Aliases:   []string{"l"},
 				Flags: []cli.Flag{
 					&cli.StringFlag{
 						Name:  "config",
-						Usage: "cloudexec.toml file path",
+						Usage: "cloudexec.toml file path (default: ./cloudexec.toml)",
+					},
+					&cli.BoolFlag{
+						Name:  "all",
+						Usage: "Launch every job defined in the launch config",
 					},
 					&cli.StringFlag{
 						Name:  "size",
@@ -99,25 +302,45 @@ func main() {
 					},
 					&cli.StringFlag{
 						Name:  "region",
-						Value: "nyc3", // Default droplet region
-						Usage: "Optional droplet region",
+						Usage: "Optional droplet region (default: your Spaces region)",
+					},
+					&cli.StringSliceFlag{
+						Name:  "label",
+						Usage: "Label the job with key=value, can be repeated and overrides labels from the launch config",
+					},
+					&cli.IntFlag{
+						Name:  "parallel",
+						Value: 4,
+						Usage: "Maximum number of droplets to create at once when launching a matrix of jobs",
+					},
+					&cli.StringFlag{
+						Name:  "host",
+						Usage: "Run the job on an existing server as [user@]address over SSH instead of on a new droplet",
+					},
+					&cli.BoolFlag{
+						Name:  "force",
+						Usage: "Do not ask for user confirmation",
 					},
 				},
 				Action: func(c *cli.Context) error {
-					config, configErr := LoadConfig(ConfigFilePath)
+					config, configErr := LoadConfig(ConfigFilePath, ConfigProfile)
 					if configErr != nil {
 						return configErr
 					}
-					// Check if a local cloudexec.toml exists
-					if _, err := os.Stat(LaunchConfigFilePath); os.IsNotExist(err) {
-						// Check if the path to a launch config is provided
-						if c.Args().Len() < 1 {
-							return fmt.Errorf("please provide a path to a cloudexec.toml file or create one in the current directory")
-						}
-						LaunchConfigFilePath = c.Args().Get(0)
+					labels, err := state.ParseLabels(c.StringSlice("label"))
+					if err != nil {
+						return err
+					}
+					launchConfigPath, args, err := LaunchConfigPathFromArgs(c)
+					if err != nil {
+						return err
 					}
-					// Load the launch configuration
-					lc, err := LoadLaunchConfig(LaunchConfigFilePath)
+					// Load the launch configuration and pick the jobs to launch
+					lcs, err := LoadLaunchConfigs(launchConfigPath)
+					if err != nil {
+						return err
+					}
+					lcs, err = SelectLaunchConfigs(lcs, args, c.Bool("all"))
 					if err != nil {
 						return err
 					}
@@ -128,8 +351,201 @@ func main() {
 					if err != nil {
 						return err
 					}
-					err = Launch(config, dropletSize, dropletRegion, lc)
-          return err
+					// Jobs launched on their own get the output of the latest completed jobs they depend on
+					var existingState *state.State
+					for i := range lcs {
+						if len(lcs[i].DependsOn) == 0 {
+							continue
+						}
+						if existingState == nil {
+							existingState, err = state.GetState(config)
+							if err != nil {
+								return err
+							}
+						}
+						lcs[i].Dependencies, err = ResolveDependencies(existingState, lcs[i])
+						if err != nil {
+							return err
+						}
+					}
+					host := c.String("host")
+					if host != "" && len(lcs) > 1 {
+						return fmt.Errorf("Only one job at a time can run on a server, launch a single job with --host")
+					}
+					results := []LaunchResult{}
+					failed := 0
+					var launchErr error
+					for _, lc := range lcs {
+						if len(labels) > 0 && lc.Labels == nil {
+							lc.Labels = make(map[string]string)
+						}
+						for key, value := range labels {
+							lc.Labels[key] = value
+						}
+						if lc.ConfigName != "" {
+							log.Info("Launching %s", lc.ConfigName)
+						}
+						var launched []LaunchResult
+						if host != "" {
+							launched, err = LaunchOnHost(config, host, lc, c.Bool("force"))
+						} else {
+							launched, err = Launch(config, dropletSize, dropletRegion, lc, c.Int("parallel"), c.Bool("force"))
+						}
+						results = append(results, launched...)
+						if err != nil {
+							launchErr = err
+							// Keep going so one broken job doesn't hold up the others
+							if len(lcs) > 1 {
+								log.Error("Failed to launch %s: %v", lc.ConfigName, err)
+								failed++
+								launchErr = fmt.Errorf("Failed to launch %d of %d jobs", failed, len(lcs))
+							}
+						}
+					}
+					if len(results) == 1 {
+						err = PrintOutput(results[0], nil)
+					} else if len(results) > 1 {
+						err = PrintOutput(results, nil)
+					}
+					if launchErr != nil {
+						err = launchErr
+					}
+					return err
+				},
+			},
+
+			{
+				Name:  "pipeline",
+				Usage: "Run jobs that depend on each other's output",
+				Subcommands: []*cli.Command{
+
+					{
+						Name:      "run",
+						Usage:     "Launch jobs and the jobs they depend on, each once its dependencies have completed",
+						ArgsUsage: "[job names...]",
+						Flags: []cli.Flag{
+							&cli.StringFlag{
+								Name:  "config",
+								Usage: "cloudexec.toml file path (default: ./cloudexec.toml)",
+							},
+							&cli.StringFlag{
+								Name:  "size",
+								Value: "c-2", // Default droplet size
+								Usage: "Optional droplet size",
+							},
+							&cli.StringFlag{
+								Name:  "region",
+								Usage: "Optional droplet region (default: your Spaces region)",
+							},
+							&cli.StringSliceFlag{
+								Name:  "label",
+								Usage: "Label the jobs with key=value, can be repeated and overrides labels from the launch config",
+							},
+							&cli.BoolFlag{
+								Name:  "force",
+								Usage: "Do not ask for user confirmation",
+							},
+						},
+						Action: func(c *cli.Context) error {
+							config, configErr := LoadConfig(ConfigFilePath, ConfigProfile)
+							if configErr != nil {
+								return configErr
+							}
+							labels, err := state.ParseLabels(c.StringSlice("label"))
+							if err != nil {
+								return err
+							}
+							launchConfigPath, args, err := LaunchConfigPathFromArgs(c)
+							if err != nil {
+								return err
+							}
+							lcs, err := LoadLaunchConfigs(launchConfigPath)
+							if err != nil {
+								return err
+							}
+							if len(lcs) == 1 && lcs[0].ConfigName == "" {
+								return fmt.Errorf("The launch config doesn't define any named jobs, add [jobs.<name>] sections with dependsOn to run them as a pipeline")
+							}
+							// Every job is run if none are named, otherwise the named jobs and everything they depend on
+							stages, err := PlanPipeline(lcs, args)
+							if err != nil {
+								return err
+							}
+							for i := range stages {
+								if len(labels) > 0 && stages[i].Labels == nil {
+									stages[i].Labels = make(map[string]string)
+								}
+								for key, value := range labels {
+									stages[i].Labels[key] = value
+								}
+							}
+							err = Init(config) // Initialize the s3 state
+							if err != nil {
+								return err
+							}
+							results, err := RunPipeline(config, stages, c.String("size"), c.String("region"), c.Bool("force"))
+							if results != nil {
+								printErr := PrintPipelineResults(results)
+								if err == nil {
+									err = printErr
+								}
+							}
+							return err
+						},
+					},
+				},
+			},
+
+			{
+				Name:      "resume",
+				Usage:     "Continue a job that timed out, failed or was stopped from its latest checkpoint on a new droplet",
+				ArgsUsage: "<job ID>",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "size",
+						Usage: "Optional droplet size (default: the size of the job being resumed)",
+					},
+					&cli.DurationFlag{
+						Name:  "timeout",
+						Usage: "How long the resumed job may run (default: what's left of the original timeout)",
+					},
+					&cli.BoolFlag{
+						Name:  "force",
+						Usage: "Do not ask for user confirmation",
+					},
+				},
+				Action: func(c *cli.Context) error {
+					if c.NArg() != 1 {
+						return fmt.Errorf("Expected a job ID, usage: cloudexec resume <job ID>")
+					}
+					jobID, err := strconv.ParseInt(c.Args().First(), 10, 64)
+					if err != nil {
+						return fmt.Errorf("Invalid job ID %s", c.Args().First())
+					}
+					config, configErr := LoadConfig(ConfigFilePath, ConfigProfile)
+					if configErr != nil {
+						return configErr
+					}
+					err = Init(config) // Initialize the s3 state
+					if err != nil {
+						return err
+					}
+					existingState, err := state.GetState(config)
+					if err != nil {
+						return err
+					}
+					job := existingState.GetJob(jobID)
+					if job == nil {
+						return fmt.Errorf("Job %v does not exist", jobID)
+					}
+					results, err := ResumeJob(config, *job, c.String("size"), c.Duration("timeout"), c.Bool("force"))
+					if err != nil {
+						return err
+					}
+					if len(results) == 1 {
+						return PrintOutput(results[0], nil)
+					}
+					return nil
 				},
 			},
 
@@ -143,9 +559,21 @@ func main() {
 						Aliases: []string{"a"},
 						Usage:   "show all jobs, including failed, cancelled, and completed",
 					},
+					&cli.StringSliceFlag{
+						Name:  "label",
+						Usage: "Only show jobs with this key=value label, can be repeated",
+					},
+					&cli.Int64Flag{
+						Name:  "sweep",
+						Usage: "Show all jobs of a sweep launched from a matrix",
+					},
+					&cli.Int64Flag{
+						Name:  "pipeline",
+						Usage: "Show all jobs launched by a pipeline",
+					},
 				},
 				Action: func(c *cli.Context) error {
-					config, configErr := LoadConfig(ConfigFilePath)
+					config, configErr := LoadConfig(ConfigFilePath, ConfigProfile)
 					if configErr != nil {
 						return configErr
 					}
@@ -153,8 +581,13 @@ func main() {
 					if err != nil {
 						return err
 					}
-					showAll := c.Bool("all")
-					err = PrintStatus(config, showAll)
+					labels, err := state.ParseLabels(c.StringSlice("label"))
+					if err != nil {
+						return err
+					}
+					filter := state.JobQuery{Labels: labels, SweepID: c.Int64("sweep"), PipelineID: c.Int64("pipeline")}
+					showAll := c.Bool("all") || filter.SweepID != 0 || filter.PipelineID != 0
+					err = PrintStatus(config, showAll, filter)
 					if err != nil {
 						return err
 					}
@@ -163,21 +596,69 @@ func main() {
 			},
 
 			{
-				Name:  "pull",
-				Usage: "Pulls down the results of the latest successful job",
+				Name:  "report",
+				Usage: "Summarize the spend, runtime and success rate of all jobs, including cleaned ones",
 				Flags: []cli.Flag{
-					&cli.IntFlag{
-						Name:  "job",
-						Value: 0,
-						Usage: "Optional job ID to pull results from",
+					&cli.StringFlag{
+						Name:  "by",
+						Value: strings.Join(ReportGroupings, ","),
+						Usage: "Comma-separated list of groupings to summarize jobs by",
+					},
+					&cli.StringSliceFlag{
+						Name:  "user",
+						Usage: "Include jobs from this user's bucket, may be given multiple times (default: your username)",
 					},
+					&cli.StringSliceFlag{
+						Name:  "label",
+						Usage: "Only include jobs with this key=value label, can be repeated",
+					},
+					&cli.StringFlag{
+						Name:  "format",
+						Value: "table",
+						Usage: "Output format, one of table, csv, json, yaml (default: the global --output format)",
+					},
+				},
+				Action: func(c *cli.Context) error {
+					config, configErr := LoadConfig(ConfigFilePath, ConfigProfile)
+					if configErr != nil {
+						return configErr
+					}
+					err := Init(config) // Initialize the s3 state
+					if err != nil {
+						return err
+					}
+					labels, err := state.ParseLabels(c.StringSlice("label"))
+					if err != nil {
+						return err
+					}
+					jobs, err := CollectReportJobs(config, c.StringSlice("user"))
+					if err != nil {
+						return err
+					}
+					jobs = FilterReportJobs(jobs, state.JobQuery{Labels: labels})
+					rows, err := BuildReport(jobs, strings.Split(c.String("by"), ","))
+					if err != nil {
+						return err
+					}
+					format := c.String("format")
+					if !c.IsSet("format") && IsStructuredOutput() {
+						format = OutputFormat
+					}
+					return PrintReport(rows, format)
+				},
+			},
+
+			{
+				Name:  "pull",
+				Usage: "Pulls down the results of the latest successful job",
+				Flags: append(JobSelectorFlags(),
 					&cli.StringFlag{
 						Name:  "path",
 						Usage: "Optional directory name where pulled data will be saved",
 					},
-				},
+				),
 				Action: func(c *cli.Context) error {
-					config, configErr := LoadConfig(ConfigFilePath)
+					config, configErr := LoadConfig(ConfigFilePath, ConfigProfile)
 					if configErr != nil {
 						return configErr
 					}
@@ -189,35 +670,48 @@ func main() {
 					if err != nil {
 						return err
 					}
-					jobID := c.Int64("job")
-					if jobID == 0 {
+					jobs, err := SelectJobs(c, existingState, func() ([]state.Job, error) {
 						latestCompletedJob, err := existingState.GetLatestCompletedJob()
+						if err != nil {
+							return nil, err
+						}
+						return []state.Job{*latestCompletedJob}, nil
+					})
+					if err != nil || jobs == nil {
+						return err
+					}
+					results := []*PullResult{}
+					for _, job := range jobs {
+						path := c.String("path")
+						if path == "" && c.Int64("sweep") != 0 {
+							// Keep the results of a sweep together
+							path = fmt.Sprintf("cloudexec/sweep-%v", c.Int64("sweep"))
+						}
+						if path == "" {
+							path = fmt.Sprintf("cloudexec/job-%v", job.ID)
+						} else if len(jobs) > 1 || c.Int64("sweep") != 0 {
+							// Keep the output of each job apart when pulling several at once
+							path = filepath.Join(path, fmt.Sprintf("job-%v", job.ID))
+						}
+						result, err := DownloadJobOutput(config, job.ID, path)
 						if err != nil {
 							return err
 						}
-						jobID = latestCompletedJob.ID
+						results = append(results, result)
 					}
-					path := c.String("path")
-					if path == "" {
-						path = fmt.Sprintf("cloudexec/job-%v", jobID)
+					if len(results) == 1 {
+						return PrintOutput(results[0], nil)
 					}
-					err = DownloadJobOutput(config, jobID, path)
-					return err
+					return PrintOutput(results, nil)
 				},
 			},
 
 			{
 				Name:  "logs",
 				Usage: "Stream logs from a running job",
-				Flags: []cli.Flag{
-					&cli.IntFlag{
-						Name:  "job",
-						Value: 0,
-						Usage: "Optional job ID to get logs from",
-					},
-				},
+				Flags: JobSelectorFlags(),
 				Action: func(c *cli.Context) error {
-					config, configErr := LoadConfig(ConfigFilePath)
+					config, configErr := LoadConfig(ConfigFilePath, ConfigProfile)
 					if configErr != nil {
 						return configErr
 					}
@@ -229,33 +723,35 @@ func main() {
 					if err != nil {
 						return err
 					}
-					// Determine the job id
-					jobID := c.Int64("job")
-					var targetJob *state.Job
-					// Get logs from the latest job if specific ID was not provided
-					if jobID == 0 {
-						targetJob = existingState.GetLatestJob()
-						if targetJob == nil {
-							return fmt.Errorf("No jobs are available")
-						}
-						jobID = targetJob.ID
-					} else {
-						targetJob = existingState.GetJob(jobID)
-						if targetJob == nil {
-							return fmt.Errorf("Job %v does not exist", jobID)
+					// Get logs from the latest job if no jobs were selected
+					jobs, err := SelectJobs(c, existingState, func() ([]state.Job, error) {
+						latestJob := existingState.GetLatestJob()
+						if latestJob == nil {
+							return nil, fmt.Errorf("No jobs are available")
 						}
+						return []state.Job{*latestJob}, nil
+					})
+					if err != nil || jobs == nil {
+						return err
 					}
-					// If the target job is running, stream logs
-					jobStatus := targetJob.Status
-					if jobStatus == state.Provisioning || jobStatus == state.Running {
-						err = ssh.StreamLogs(jobID)
-						if err != nil {
-							return err
-						}
-					} else { // Otherwise pull from bucket
-						err := GetLogsFromBucket(config, jobID)
-						if err != nil {
-							return err
+					for i, targetJob := range jobs {
+						// If the target job is running, stream logs
+						jobStatus := targetJob.Status
+						if jobStatus == state.Provisioning || jobStatus == state.Running {
+							// Streaming never ends on its own so it's only possible for a single job
+							if len(jobs) > 1 {
+								log.Warn("Skipping job %v which is still running, stream its logs with: cloudexec logs --job %v", targetJob.ID, targetJob.ID)
+								continue
+							}
+							err = ssh.StreamLogs(JobSSHTarget(&jobs[i]))
+							if err != nil {
+								return err
+							}
+						} else { // Otherwise pull from bucket
+							err := GetLogsFromBucket(config, targetJob.ID)
+							if err != nil {
+								return err
+							}
 						}
 					}
 					return nil
@@ -267,7 +763,7 @@ func main() {
 				Aliases: []string{"a"},
 				Usage:   "Attach to a running job",
 				Action: func(*cli.Context) error {
-					config, configErr := LoadConfig(ConfigFilePath)
+					config, configErr := LoadConfig(ConfigFilePath, ConfigProfile)
 					if configErr != nil {
 						return configErr
 					}
@@ -287,7 +783,26 @@ func main() {
 					jobStatus := targetJob.Status
 					// Attach to the running job with tmux
 					if jobStatus == state.Running {
-						err = ssh.AttachToTmuxSession(targetJob.ID)
+						// Forward the ports listed in the job's launch config for as long as we're attached
+						if len(targetJob.Ports) > 0 {
+							forwards, err := ParsePortForwards(targetJob.Ports)
+							if err != nil {
+								return err
+							}
+							forwarder, err := ssh.StartPortForwarding(JobSSHTarget(targetJob), forwards)
+							if err != nil {
+								log.Warn("Failed to forward ports, attaching anyway: %v", err)
+							} else {
+								defer forwarder.Close()
+								for _, forward := range forwards {
+									log.Good("Forwarding localhost:%d to port %d", forward.LocalPort, forward.RemotePort)
+								}
+								// Log forwarding problems once the terminal is back to normal
+								forwarder.DeferWarnings()
+								defer forwarder.FlushWarnings()
+							}
+						}
+						err = ssh.AttachToTmuxSession(JobSSHTarget(targetJob))
 						if err != nil {
 							return err
 						}
@@ -301,21 +816,70 @@ func main() {
 			},
 
 			{
-				Name:  "cancel",
-				Usage: "Cancels any running cloudexec jobs",
+				Name:      "exec",
+				Usage:     "Run a command on the droplet of a running job",
+				ArgsUsage: "-- <command> [args...]",
 				Flags: []cli.Flag{
 					&cli.IntFlag{
 						Name:  "job",
 						Value: 0,
-						Usage: "Optional job ID to get logs from",
+						Usage: "Optional job ID to run the command on",
 					},
-					&cli.BoolFlag{
-						Name:  "force",
-						Usage: "Do not ask for user confirmation",
+				},
+				Action: func(c *cli.Context) error {
+					if c.NArg() == 0 {
+						return fmt.Errorf("No command given, usage: cloudexec exec [--job N] -- <command>")
+					}
+					config, configErr := LoadConfig(ConfigFilePath, ConfigProfile)
+					if configErr != nil {
+						return configErr
+					}
+					err := Init(config) // Initialize the s3 state
+					if err != nil {
+						return err
+					}
+					existingState, err := state.GetState(config)
+					if err != nil {
+						return err
+					}
+					targetJob, err := GetActiveJob(existingState, c.Int64("job"))
+					if err != nil {
+						return err
+					}
+					// Like ssh, the arguments are joined and interpreted by the remote shell
+					exitCode, err := ssh.RunCommand(JobSSHTarget(targetJob), strings.Join(c.Args().Slice(), " "))
+					if err != nil {
+						return err
+					}
+					if exitCode != 0 {
+						return cli.Exit("", exitCode)
+					}
+					return nil
+				},
+			},
+
+			{
+				Name:      "extend",
+				Usage:     "Change when a running job times out",
+				ArgsUsage: "[duration]",
+				Description: "Moves the timeout of a running job by a duration like 12h or 2d, or to an absolute time with --until.\n" +
+					"Use a negative duration to shorten the job, eg 'cloudexec extend -- -2h'.",
+				Flags: []cli.Flag{
+					&cli.IntFlag{
+						Name:  "job",
+						Value: 0,
+						Usage: "Optional job ID to extend, defaults to the latest job",
+					},
+					&cli.StringFlag{
+						Name:  "until",
+						Usage: "Time out at this time instead, eg '2024-01-02 15:04' or 18:30",
 					},
 				},
 				Action: func(c *cli.Context) error {
-					config, configErr := LoadConfig(ConfigFilePath)
+					if (c.NArg() == 0) == (c.String("until") == "") {
+						return fmt.Errorf("Give either a duration or --until, usage: cloudexec extend [--job N] <duration>")
+					}
+					config, configErr := LoadConfig(ConfigFilePath, ConfigProfile)
 					if configErr != nil {
 						return configErr
 					}
@@ -327,45 +891,145 @@ func main() {
 					if err != nil {
 						return err
 					}
-					force := c.Bool("force")
-					jobID := c.Int64("job")
 					var targetJob *state.Job
-					if jobID == 0 {
+					if jobID := c.Int64("job"); jobID != 0 {
+						targetJob = existingState.GetJob(jobID)
+						if targetJob == nil {
+							return fmt.Errorf("Job %v does not exist", jobID)
+						}
+					} else {
 						targetJob = existingState.GetLatestJob()
 						if targetJob == nil {
 							return fmt.Errorf("No jobs are available")
 						}
-						// TODO: error if no jobs present
+					}
+
+					var deadline time.Time
+					if c.String("until") != "" {
+						deadline, err = ParseDeadline(c.String("until"), time.Now())
+						if err != nil {
+							return err
+						}
 					} else {
-						targetJob = existingState.GetJob(jobID)
-						if targetJob == nil {
-							return fmt.Errorf("Job %v does not exist", jobID)
+						extension, err := ParseExtension(c.Args().First())
+						if err != nil {
+							return err
+						}
+						if targetJob.Deadline == 0 {
+							return fmt.Errorf("Job %v hasn't started running yet, use --until to give it an absolute deadline", targetJob.ID)
 						}
+						deadline = time.Unix(targetJob.Deadline, 0).Add(extension)
+					}
+					return ExtendJob(config, *targetJob, deadline)
+				},
+			},
+
+			{
+				Name:      "cp",
+				Usage:     "Copy files to or from the droplet of a running job",
+				ArgsUsage: "<source> <destination>, where remote paths are prefixed with a colon eg ':/root/output'",
+				Flags: []cli.Flag{
+					&cli.IntFlag{
+						Name:  "job",
+						Value: 0,
+						Usage: "Optional job ID to copy files to or from",
+					},
+				},
+				Action: func(c *cli.Context) error {
+					if c.NArg() != 2 {
+						return fmt.Errorf("Expected a source and a destination, usage: cloudexec cp [--job N] <source> <destination>")
+					}
+					upload, localPath, remotePath, err := ParseCopyArgs(c.Args().Get(0), c.Args().Get(1))
+					if err != nil {
+						return err
+					}
+					config, configErr := LoadConfig(ConfigFilePath, ConfigProfile)
+					if configErr != nil {
+						return configErr
+					}
+					err = Init(config) // Initialize the s3 state
+					if err != nil {
+						return err
+					}
+					existingState, err := state.GetState(config)
+					if err != nil {
+						return err
 					}
-					err = CancelJob(config, existingState, targetJob, force)
+					targetJob, err := GetActiveJob(existingState, c.Int64("job"))
 					if err != nil {
 						return err
 					}
+					target := JobSSHTarget(targetJob)
+					if upload {
+						log.Wait("Copying %s to %s on job %v", localPath, remotePath, targetJob.ID)
+						err = ssh.Upload(target, localPath, remotePath)
+					} else {
+						log.Wait("Copying %s on job %v to %s", remotePath, targetJob.ID, localPath)
+						err = ssh.Download(target, remotePath, localPath)
+					}
+					if err != nil {
+						return err
+					}
+					log.Good("Copy complete")
 					return nil
 				},
 			},
 
 			{
-				Name:  "clean",
-				Usage: "Cleans up any running cloudexec droplets and clears the spaces bucket",
+				Name:      "forward",
+				Usage:     "Forward local ports to the droplet of a running job",
+				ArgsUsage: "<local>:<remote> [<local>:<remote>...]",
 				Flags: []cli.Flag{
 					&cli.IntFlag{
 						Name:  "job",
 						Value: 0,
-						Usage: "Optional job ID to get logs from",
+						Usage: "Optional job ID to forward ports to",
+					},
+				},
+				Action: func(c *cli.Context) error {
+					if c.NArg() == 0 {
+						return fmt.Errorf("No ports given, usage: cloudexec forward [--job N] <local>:<remote>")
+					}
+					forwards, err := ParsePortForwards(c.Args().Slice())
+					if err != nil {
+						return err
+					}
+					config, configErr := LoadConfig(ConfigFilePath, ConfigProfile)
+					if configErr != nil {
+						return configErr
+					}
+					err = Init(config) // Initialize the s3 state
+					if err != nil {
+						return err
+					}
+					existingState, err := state.GetState(config)
+					if err != nil {
+						return err
+					}
+					targetJob, err := GetActiveJob(existingState, c.Int64("job"))
+					if err != nil {
+						return err
+					}
+					return ForwardPortsUntilInterrupted(targetJob, forwards)
+				},
+			},
+
+			{
+				Name:  "stop",
+				Usage: "Interrupts running jobs and uploads their output and logs before destroying their droplets",
+				Flags: append(JobSelectorFlags(),
+					&cli.DurationFlag{
+						Name:  "grace-period",
+						Value: DefaultStopGracePeriod,
+						Usage: "How long the workload has to exit after being interrupted before its droplet is destroyed",
 					},
 					&cli.BoolFlag{
 						Name:  "force",
 						Usage: "Do not ask for user confirmation",
 					},
-				},
+				),
 				Action: func(c *cli.Context) error {
-					config, configErr := LoadConfig(ConfigFilePath)
+					config, configErr := LoadConfig(ConfigFilePath, ConfigProfile)
 					if configErr != nil {
 						return configErr
 					}
@@ -377,37 +1041,88 @@ func main() {
 					if err != nil {
 						return err
 					}
-					force := c.Bool("force")
-					jobID := c.Int64("job")
-					if jobID == 0 { // If no job provided, clean everything
-						// Cancel running servers
-						err = CancelAll(config, existingState, force)
-						if err != nil {
-							return err
+					// Stop the latest job if no jobs were selected
+					jobs, err := SelectJobs(c, existingState, func() ([]state.Job, error) {
+						latestJob := existingState.GetLatestJob()
+						if latestJob == nil {
+							return nil, fmt.Errorf("No jobs are available")
 						}
-						// Flag all job data for deletion
-						err = CleanAll(config, existingState, force)
-						if err != nil {
-							return err
-						}
-					} else {
-						targetJob := existingState.GetJob(jobID)
-						if targetJob == nil {
-							return fmt.Errorf("Job %v does not exist", jobID)
-						}
-						// Cancel servers associated with this job if they're running
-						if targetJob.Status == state.Provisioning || targetJob.Status == state.Running {
-							err = CancelJob(config, existingState, targetJob, force)
-							if err != nil {
-								return err
-							}
-						}
-						err = CleanJob(config, existingState, jobID, force)
-						if err != nil {
-							return err
+						return []state.Job{*latestJob}, nil
+					})
+					if err != nil || jobs == nil {
+						return err
+					}
+					return StopJobs(config, existingState, jobs, c.Duration("grace-period"), c.Bool("force"))
+				},
+			},
+
+			{
+				Name:  "cancel",
+				Usage: "Cancels any running cloudexec jobs",
+				Flags: append(JobSelectorFlags(),
+					&cli.BoolFlag{
+						Name:  "force",
+						Usage: "Do not ask for user confirmation",
+					},
+				),
+				Action: func(c *cli.Context) error {
+					config, configErr := LoadConfig(ConfigFilePath, ConfigProfile)
+					if configErr != nil {
+						return configErr
+					}
+					err := Init(config) // Initialize the s3 state
+					if err != nil {
+						return err
+					}
+					existingState, err := state.GetState(config)
+					if err != nil {
+						return err
+					}
+					// Cancel the latest job if no jobs were selected
+					jobs, err := SelectJobs(c, existingState, func() ([]state.Job, error) {
+						latestJob := existingState.GetLatestJob()
+						if latestJob == nil {
+							return nil, fmt.Errorf("No jobs are available")
 						}
+						return []state.Job{*latestJob}, nil
+					})
+					if err != nil || jobs == nil {
+						return err
 					}
-					return nil
+					return CancelJobs(config, existingState, jobs, c.Bool("force"))
+				},
+			},
+
+			{
+				Name:  "clean",
+				Usage: "Cleans up any running cloudexec droplets and clears the spaces bucket",
+				Flags: append(JobSelectorFlags(),
+					&cli.BoolFlag{
+						Name:  "force",
+						Usage: "Do not ask for user confirmation",
+					},
+				),
+				Action: func(c *cli.Context) error {
+					config, configErr := LoadConfig(ConfigFilePath, ConfigProfile)
+					if configErr != nil {
+						return configErr
+					}
+					err := Init(config) // Initialize the s3 state
+					if err != nil {
+						return err
+					}
+					existingState, err := state.GetState(config)
+					if err != nil {
+						return err
+					}
+					// If no jobs were selected, clean everything
+					jobs, err := SelectJobs(c, existingState, func() ([]state.Job, error) {
+						return append([]state.Job{}, existingState.Jobs...), nil
+					})
+					if err != nil || jobs == nil {
+						return err
+					}
+					return CleanJobs(config, existingState, jobs, c.Bool("force"))
 				},
 			},
 
@@ -430,7 +1145,7 @@ func main() {
 					},
 				},
 				Action: func(c *cli.Context) error {
-					config, configErr := LoadConfig(ConfigFilePath)
+					config, configErr := LoadConfig(ConfigFilePath, ConfigProfile)
 					if configErr != nil {
 						return configErr
 					}
@@ -462,17 +1177,21 @@ func main() {
 						path = fmt.Sprintf("cloudexec/job-%v", jobID)
 					}
 					// Pull all data
-					err = DownloadJobOutput(config, jobID, path)
+					_, err = DownloadJobOutput(config, jobID, path)
 					if err != nil {
 						return err
 					}
 					force := c.Bool("force")
 					// Cancel servers associated with this job if they're running
 					if targetJob.Status == state.Provisioning || targetJob.Status == state.Running {
-						err = CancelJob(config, existingState, targetJob, force)
+						cancelled, err := CancelJob(config, existingState, targetJob, force)
 						if err != nil {
 							return err
 						}
+						if !cancelled {
+							log.Info("Job %v was not cleaned since it's still running", jobID)
+							return nil
+						}
 					}
 					// Clean this job's data out of the bucket
 					err = CleanJob(config, existingState, jobID, force)
@@ -489,7 +1208,7 @@ func main() {
 						Name:  "list",
 						Usage: "List jobs in the state file",
 						Action: func(c *cli.Context) error {
-							config, configErr := LoadConfig(ConfigFilePath)
+							config, configErr := LoadConfig(ConfigFilePath, ConfigProfile)
 							if configErr != nil {
 								return configErr
 							}
@@ -503,10 +1222,12 @@ func main() {
 								return err
 							}
 							// Print the jobs from the state
-							for _, job := range existingState.Jobs {
-								log.Info("Job ID: %d, Status: %s", job.ID, job.Status)
-							}
-							return nil
+							return PrintOutput(existingState.Jobs, func() error {
+								for _, job := range existingState.Jobs {
+									fmt.Printf("Job ID: %d, Status: %s\n", job.ID, job.Status)
+								}
+								return nil
+							})
 						},
 					},
 
@@ -514,7 +1235,7 @@ func main() {
 						Name:  "rm",
 						Usage: "Remove a job from the state file",
 						Action: func(c *cli.Context) error {
-							config, configErr := LoadConfig(ConfigFilePath)
+							config, configErr := LoadConfig(ConfigFilePath, ConfigProfile)
 							if configErr != nil {
 								return configErr
 							}
@@ -551,7 +1272,7 @@ func main() {
 						Name:  "json",
 						Usage: "Output the raw state file as JSON",
 						Action: func(c *cli.Context) error {
-							config, configErr := LoadConfig(ConfigFilePath)
+							config, configErr := LoadConfig(ConfigFilePath, ConfigProfile)
 							if configErr != nil {
 								return configErr
 							}
@@ -564,13 +1285,8 @@ func main() {
 							if err != nil {
 								return err
 							}
-							// output the raw json
-							json, err := json.MarshalIndent(existingState, "", "  ")
-							if err != nil {
-								return err
-							}
-							log.Info(string(json))
-							return nil
+							// output the raw json without any log formatting so it can be piped to other tools
+							return WriteStructured(os.Stdout, JSONOutput, existingState)
 						},
 					},
 				},
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Matches '{{ matrix.<name> }}' placeholders in commands
+var matrixPlaceholder = regexp.MustCompile(`\{\{\s*matrix\.([A-Za-z0-9_-]+)\s*\}\}`)
+
+// ExpandMatrix returns one launch config per combination of the values in the matrix section, with the
+// matrix variables substituted into the commands. A launch config without a matrix is returned as is.
+func ExpandMatrix(lc LaunchConfig) ([]LaunchConfig, error) {
+	// Iterate over variables in a stable order so the jobs of a sweep always come out the same way
+	names := make([]string, 0, len(lc.Matrix))
+	for name, values := range lc.Matrix {
+		if len(values) == 0 {
+			return nil, fmt.Errorf("Matrix variable %s has no values", name)
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	// Build every combination of values, varying the last variable fastest
+	combinations := []map[string]string{{}}
+	for _, name := range names {
+		var expanded []map[string]string
+		for _, combination := range combinations {
+			for _, value := range lc.Matrix[name] {
+				next := make(map[string]string, len(combination)+1)
+				for k, v := range combination {
+					next[k] = v
+				}
+				next[name] = fmt.Sprint(value)
+				expanded = append(expanded, next)
+			}
+		}
+		combinations = expanded
+	}
+
+	lcs := make([]LaunchConfig, 0, len(combinations))
+	for _, combination := range combinations {
+		expanded := lc
+		var err error
+		expanded.Commands.Setup, err = substituteMatrix(lc.Commands.Setup, combination)
+		if err != nil {
+			return nil, err
+		}
+		expanded.Commands.Run, err = substituteMatrix(lc.Commands.Run, combination)
+		if err != nil {
+			return nil, err
+		}
+		if len(names) > 0 {
+			expanded.MatrixValues = combination
+			// Tell the jobs of a sweep apart by the values they were given
+			pairs := make([]string, len(names))
+			for i, name := range names {
+				pairs[i] = name + "=" + combination[name]
+			}
+			expanded.Input.JobName = strings.TrimSpace(fmt.Sprintf("%s [%s]", lc.Input.JobName, strings.Join(pairs, " ")))
+		}
+		lcs = append(lcs, expanded)
+	}
+	return lcs, nil
+}
+
+// substituteMatrix replaces matrix placeholders in a command with the given values
+func substituteMatrix(command string, values map[string]string) (string, error) {
+	var err error
+	substituted := matrixPlaceholder.ReplaceAllStringFunc(command, func(placeholder string) string {
+		name := matrixPlaceholder.FindStringSubmatch(placeholder)[1]
+		value, ok := values[name]
+		if !ok {
+			err = fmt.Errorf("Command refers to %s but there's no matrix variable named %s", placeholder, name)
+			return placeholder
+		}
+		return value
+	})
+	return substituted, err
+}
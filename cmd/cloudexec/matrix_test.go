@@ -0,0 +1,70 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestExpandMatrix(t *testing.T) {
+	lc := LaunchConfig{}
+	lc.Input.JobName = "fuzz"
+	lc.Commands.Setup = "echo {{ matrix.contract }}"
+	lc.Commands.Run = "medusa fuzz --target {{matrix.contract}} --seed {{ matrix.seed }}"
+	lc.Matrix = map[string][]interface{}{
+		"seed":     {int64(1), int64(2)},
+		"contract": {"Vault", "Token"},
+	}
+
+	lcs, err := ExpandMatrix(lc)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expectedRuns := []string{
+		"medusa fuzz --target Vault --seed 1",
+		"medusa fuzz --target Vault --seed 2",
+		"medusa fuzz --target Token --seed 1",
+		"medusa fuzz --target Token --seed 2",
+	}
+	if len(lcs) != len(expectedRuns) {
+		t.Fatalf("Expected %d jobs, got %d", len(expectedRuns), len(lcs))
+	}
+	for i, expected := range expectedRuns {
+		if lcs[i].Commands.Run != expected {
+			t.Errorf("Expected job %d to run %q, got %q", i, expected, lcs[i].Commands.Run)
+		}
+	}
+	if lcs[0].Commands.Setup != "echo Vault" {
+		t.Errorf("Expected setup to be substituted, got %q", lcs[0].Commands.Setup)
+	}
+	if lcs[0].Input.JobName != "fuzz [contract=Vault seed=1]" {
+		t.Errorf("Unexpected job name %q", lcs[0].Input.JobName)
+	}
+	if lcs[3].MatrixValues["contract"] != "Token" || lcs[3].MatrixValues["seed"] != "2" {
+		t.Errorf("Unexpected matrix values %v", lcs[3].MatrixValues)
+	}
+}
+
+func TestExpandMatrixWithoutMatrix(t *testing.T) {
+	lc := LaunchConfig{}
+	lc.Input.JobName = "fuzz"
+	lc.Commands.Run = "medusa fuzz"
+
+	lcs, err := ExpandMatrix(lc)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(lcs) != 1 || lcs[0].Input.JobName != "fuzz" || lcs[0].MatrixValues != nil {
+		t.Errorf("Expected the launch config to be returned as is, got %+v", lcs)
+	}
+}
+
+func TestExpandMatrixErrors(t *testing.T) {
+	lc := LaunchConfig{}
+	lc.Commands.Run = "medusa fuzz --seed {{ matrix.seed }}"
+	if _, err := ExpandMatrix(lc); err == nil {
+		t.Errorf("Expected an error for an undefined matrix variable")
+	}
+	lc.Matrix = map[string][]interface{}{"seed": {}}
+	if _, err := ExpandMatrix(lc); err == nil {
+		t.Errorf("Expected an error for a matrix variable without values")
+	}
+}
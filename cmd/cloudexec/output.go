@@ -0,0 +1,97 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Formats that command results can be printed in, selected with the global --output flag
+const (
+	TableOutput = "table"
+	JSONOutput  = "json"
+	YAMLOutput  = "yaml"
+)
+
+// OutputFormat is the format in which command results are printed to stdout
+var OutputFormat = TableOutput
+
+// ValidateOutputFormat returns an error if the given output format is not supported
+func ValidateOutputFormat(format string) error {
+	switch format {
+	case TableOutput, JSONOutput, YAMLOutput:
+		return nil
+	}
+	return fmt.Errorf("Unknown output format %s, expected one of %s, %s, %s", format, TableOutput, JSONOutput, YAMLOutput)
+}
+
+// IsStructuredOutput returns true if results should be machine-readable rather than human-readable
+func IsStructuredOutput() bool {
+	return OutputFormat == JSONOutput || OutputFormat == YAMLOutput
+}
+
+// PrintOutput writes a command's result to stdout in the selected output format.
+// In table mode, printTable is responsible for rendering the result for humans and may be nil.
+func PrintOutput(data interface{}, printTable func() error) error {
+	if IsStructuredOutput() {
+		return WriteStructured(os.Stdout, OutputFormat, data)
+	}
+	if printTable == nil {
+		return nil
+	}
+	return printTable()
+}
+
+// WriteStructured encodes data as JSON or YAML, YAML keys are the same as the JSON keys
+func WriteStructured(w io.Writer, format string, data interface{}) error {
+	dataJSON, err := json.MarshalIndent(data, "", "  ")
+	if err != nil {
+		return fmt.Errorf("Failed to marshal output to JSON: %w", err)
+	}
+	if format == JSONOutput {
+		_, err = fmt.Fprintln(w, string(dataJSON))
+		return err
+	}
+	// Round trip through JSON so that the json struct tags are respected
+	var generic interface{}
+	decoder := json.NewDecoder(bytes.NewReader(dataJSON))
+	decoder.UseNumber()
+	err = decoder.Decode(&generic)
+	if err != nil {
+		return fmt.Errorf("Failed to decode output JSON: %w", err)
+	}
+	dataYAML, err := yaml.Marshal(convertJSONNumbers(generic))
+	if err != nil {
+		return fmt.Errorf("Failed to marshal output to YAML: %w", err)
+	}
+	_, err = w.Write(dataYAML)
+	return err
+}
+
+// convertJSONNumbers replaces decoded JSON numbers with ints or floats so that large
+// integers like timestamps aren't printed in scientific notation
+func convertJSONNumbers(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, item := range v {
+			v[key] = convertJSONNumbers(item)
+		}
+	case []interface{}:
+		for i, item := range v {
+			v[i] = convertJSONNumbers(item)
+		}
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i
+		}
+		if f, err := v.Float64(); err == nil {
+			return f
+		}
+		return v.String()
+	}
+	return value
+}
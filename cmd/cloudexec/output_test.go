@@ -0,0 +1,29 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestWriteStructuredYAML(t *testing.T) {
+	data := LaunchResult{
+		JobID:       3,
+		DropletName: "cloudexec-test-3",
+		DropletID:   1700000001,
+		IP:          "12.34.56.78",
+	}
+
+	var buffer bytes.Buffer
+	err := WriteStructured(&buffer, YAMLOutput, data)
+	if err != nil {
+		t.Fatalf("Failed to write YAML: %v", err)
+	}
+
+	// YAML keys should match the JSON keys and large integers shouldn't use scientific notation
+	for _, substring := range []string{"jobId: 3", "dropletName: cloudexec-test-3", "dropletId: 1700000001", "ip: 12.34.56.78"} {
+		if !strings.Contains(buffer.String(), substring) {
+			t.Errorf("Expected YAML output to contain %q, got:\n%s", substring, buffer.String())
+		}
+	}
+}
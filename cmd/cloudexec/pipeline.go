@@ -0,0 +1,320 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/crytic/cloudexec/pkg/config"
+	"github.com/crytic/cloudexec/pkg/log"
+	"github.com/crytic/cloudexec/pkg/state"
+	"github.com/olekukonko/tablewriter"
+)
+
+// How often the pipeline checks on the jobs it launched
+const pipelinePollInterval = 30 * time.Second
+
+// Statuses of pipeline stages that don't have a job, or whose job couldn't be launched
+const (
+	pipelinePending      = "pending"
+	pipelineSkipped      = "skipped"
+	pipelineLaunchFailed = "launch-failed"
+)
+
+// Dependency names are passed to the droplet in its user data and used as directory names
+var dependencyNamePattern = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
+
+// PipelineStage is set on the launch config of a job launched by a pipeline
+type PipelineStage struct {
+	// ID of the pipeline, zero for its first job whose own ID becomes the pipeline's
+	ID int64
+}
+
+// PipelineResult describes a stage of a pipeline and the job that ran it, if any
+type PipelineResult struct {
+	Name      string   `json:"name"`
+	DependsOn []string `json:"dependsOn,omitempty"`
+	JobID     int64    `json:"jobId,omitempty"`
+	Status    string   `json:"status"`
+}
+
+// validateDependencies checks that the dependencies of the jobs in a launch config exist and don't form a cycle
+func validateDependencies(lcs []LaunchConfig) error {
+	for _, lc := range lcs {
+		if len(lc.DependsOn) == 0 {
+			continue
+		}
+		if lc.ConfigName == "" {
+			return fmt.Errorf("dependsOn can only be set on jobs defined in [jobs.<name>] sections")
+		}
+		seen := make(map[string]bool, len(lc.DependsOn))
+		for _, dependency := range lc.DependsOn {
+			if !dependencyNamePattern.MatchString(dependency) {
+				return fmt.Errorf("Job %s depends on %s, the names of jobs that others depend on may only contain letters, digits, '_', '-' and '.'", lc.ConfigName, dependency)
+			}
+			if seen[dependency] {
+				return fmt.Errorf("Job %s depends on %s more than once", lc.ConfigName, dependency)
+			}
+			seen[dependency] = true
+		}
+	}
+	_, err := PlanPipeline(lcs, nil)
+	return err
+}
+
+// PlanPipeline returns the named jobs, or every job if no names are given, along with the jobs they depend on,
+// ordered so that every job comes after its dependencies
+func PlanPipeline(lcs []LaunchConfig, names []string) ([]LaunchConfig, error) {
+	byName := make(map[string]LaunchConfig, len(lcs))
+	for _, lc := range lcs {
+		byName[lc.ConfigName] = lc
+	}
+	if len(names) == 0 {
+		for _, lc := range lcs {
+			names = append(names, lc.ConfigName)
+		}
+	}
+
+	// Depth first search, jobs are added once all of their dependencies have been
+	const (
+		visiting = 1
+		visited  = 2
+	)
+	marks := make(map[string]int, len(lcs))
+	ordered := []LaunchConfig{}
+	var visit func(name string, path []string) error
+	visit = func(name string, path []string) error {
+		lc, ok := byName[name]
+		if !ok {
+			if len(path) == 0 {
+				available := make([]string, 0, len(lcs))
+				for _, lc := range lcs {
+					available = append(available, lc.ConfigName)
+				}
+				return fmt.Errorf("Job %s is not defined in the launch config. Available jobs: %s", name, strings.Join(available, ", "))
+			}
+			return fmt.Errorf("Job %s depends on %s, which is not defined in the launch config", path[len(path)-1], name)
+		}
+		path = append(path, name)
+		switch marks[name] {
+		case visited:
+			return nil
+		case visiting:
+			return fmt.Errorf("The dependencies of job %s form a cycle: %s", name, strings.Join(path, " -> "))
+		}
+		marks[name] = visiting
+		for _, dependency := range lc.DependsOn {
+			err := visit(dependency, path)
+			if err != nil {
+				return err
+			}
+		}
+		marks[name] = visited
+		ordered = append(ordered, lc)
+		return nil
+	}
+	for _, name := range names {
+		err := visit(name, nil)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return ordered, nil
+}
+
+// ResolveDependencies picks the latest completed job of each job a launch config depends on, for jobs launched
+// on their own rather than by a pipeline
+func ResolveDependencies(existingState *state.State, lc LaunchConfig) (map[string]int64, error) {
+	dependencies := make(map[string]int64, len(lc.DependsOn))
+	for _, dependency := range lc.DependsOn {
+		for i := len(existingState.Jobs) - 1; i >= 0; i-- {
+			job := existingState.Jobs[i]
+			if job.Status == state.Completed && job.ConfigName == dependency && job.Project == lc.Project {
+				dependencies[dependency] = job.ID
+				break
+			}
+		}
+		if _, ok := dependencies[dependency]; !ok {
+			return nil, fmt.Errorf("Job %s depends on %s, which has never completed. Launch them both with 'cloudexec pipeline run %s'", lc.ConfigName, dependency, lc.ConfigName)
+		}
+		log.Info("Job %s will use the output of job %v (%s)", lc.ConfigName, dependencies[dependency], dependency)
+	}
+	return dependencies, nil
+}
+
+// FormatDependencies turns a job's dependencies into space separated name:jobID pairs, sorted by name
+func FormatDependencies(dependencies map[string]int64) string {
+	names := make([]string, 0, len(dependencies))
+	for name := range dependencies {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	pairs := make([]string, 0, len(names))
+	for _, name := range names {
+		pairs = append(pairs, fmt.Sprintf("%s:%d", name, dependencies[name]))
+	}
+	return strings.Join(pairs, " ")
+}
+
+// RunPipeline launches each stage of a pipeline once all of the stages it depends on have completed, and waits
+// until every stage has finished. Stages that depend on one that didn't complete are skipped. The stages must
+// be ordered as returned by PlanPipeline.
+func RunPipeline(config config.Config, stages []LaunchConfig, serverSize string, serverRegion string, force bool) ([]PipelineResult, error) {
+	results := make([]PipelineResult, len(stages))
+	index := make(map[string]int, len(stages))
+	log.Info("The pipeline runs %d job(s):", len(stages))
+	for i, stage := range stages {
+		if len(stage.Matrix) > 0 {
+			return nil, fmt.Errorf("Job %s has a matrix, pipelines can't run sweeps yet", stage.ConfigName)
+		}
+		results[i] = PipelineResult{Name: stage.ConfigName, DependsOn: stage.DependsOn, Status: pipelinePending}
+		index[stage.ConfigName] = i
+		if len(stage.DependsOn) == 0 {
+			log.Info("  %s", stage.ConfigName)
+		} else {
+			log.Info("  %s, after %s", stage.ConfigName, strings.Join(stage.DependsOn, ", "))
+		}
+	}
+	if !force { // Ask for confirmation once, each job is launched without asking when its turn comes
+		log.Warn("Each job will be launched without further confirmation once the jobs it depends on have completed")
+		log.Prompt("Confirm? (y/n)")
+		var response string
+		fmt.Scanln(&response)
+		if strings.ToLower(response) != "y" {
+			return nil, fmt.Errorf("Pipeline was not launched")
+		}
+	}
+
+	var pipelineID int64
+	for {
+		// Launch the stages whose dependencies have completed, and skip those whose dependencies never will.
+		// Stages come after their dependencies, so a skipped stage is seen by its dependents in the same pass.
+		for i, stage := range stages {
+			if results[i].Status != pipelinePending {
+				continue
+			}
+			ready := true
+			blockedBy := ""
+			dependencies := make(map[string]int64, len(stage.DependsOn))
+			for _, dependency := range stage.DependsOn {
+				result := results[index[dependency]]
+				if result.Status == string(state.Completed) {
+					dependencies[dependency] = result.JobID
+					continue
+				}
+				ready = false
+				if !isPipelineActive(result.Status) {
+					blockedBy = dependency
+					break
+				}
+			}
+			if blockedBy != "" {
+				log.Warn("Skipping %s because %s is %s", stage.ConfigName, blockedBy, results[index[blockedBy]].Status)
+				results[i].Status = pipelineSkipped
+				continue
+			}
+			if !ready {
+				continue
+			}
+
+			stage.Dependencies = dependencies
+			stage.Pipeline = &PipelineStage{ID: pipelineID}
+			log.Info("Launching %s", stage.ConfigName)
+			launched, err := Launch(config, serverSize, serverRegion, stage, 1, true)
+			if err != nil || len(launched) == 0 {
+				log.Error("Failed to launch %s: %v", stage.ConfigName, err)
+				results[i].Status = pipelineLaunchFailed
+				continue
+			}
+			results[i].JobID = launched[0].JobID
+			results[i].Status = string(state.Provisioning)
+			if pipelineID == 0 {
+				pipelineID = launched[0].JobID
+				log.Info("Registered pipeline %v, check on it with: cloudexec status --pipeline %v", pipelineID, pipelineID)
+			}
+		}
+
+		active := 0
+		for _, result := range results {
+			if isPipelineActive(result.Status) {
+				active++
+			}
+		}
+		if active == 0 {
+			break
+		}
+
+		// The jobs report their own progress to the state, so the pipeline only needs to watch it
+		time.Sleep(pipelinePollInterval)
+		currentState, err := state.GetState(config)
+		if err != nil {
+			log.Warn("Failed to check on the jobs of pipeline %v: %v", pipelineID, err)
+			continue
+		}
+		for i := range results {
+			if results[i].JobID == 0 || !isPipelineActive(results[i].Status) {
+				continue
+			}
+			job := currentState.GetJob(results[i].JobID)
+			if job == nil {
+				log.Warn("Job %v (%s) was removed from the state", results[i].JobID, results[i].Name)
+				results[i].Status = string(state.Failed)
+				continue
+			}
+			if string(job.Status) == results[i].Status {
+				continue
+			}
+			results[i].Status = string(job.Status)
+			switch job.Status {
+			case state.Completed:
+				log.Good("Job %v (%s) completed", job.ID, results[i].Name)
+			case state.Running:
+				log.Info("Job %v (%s) is running", job.ID, results[i].Name)
+			case state.Provisioning:
+			default:
+				log.Warn("Job %v (%s) is %s", job.ID, results[i].Name, job.Status)
+			}
+		}
+	}
+
+	failed := 0
+	for _, result := range results {
+		if result.Status != string(state.Completed) {
+			failed++
+		}
+	}
+	if pipelineID != 0 {
+		log.Info("Pull the results of the pipeline with: cloudexec pull --pipeline %v", pipelineID)
+	}
+	if failed > 0 {
+		return results, fmt.Errorf("%d of %d job(s) of the pipeline did not complete", failed, len(results))
+	}
+	return results, nil
+}
+
+// isPipelineActive returns true if a stage is waiting to be launched or its job is still running
+func isPipelineActive(status string) bool {
+	return status == pipelinePending || status == string(state.Provisioning) || status == string(state.Running)
+}
+
+// PrintPipelineResults prints the stages of a pipeline and what became of them
+func PrintPipelineResults(results []PipelineResult) error {
+	return PrintOutput(results, func() error {
+		table := tablewriter.NewWriter(os.Stdout)
+		table.SetHeader([]string{"Job", "Depends On", "Job ID", "Status"})
+		for _, result := range results {
+			jobID := "-"
+			if result.JobID != 0 {
+				jobID = strconv.FormatInt(result.JobID, 10)
+			}
+			table.Append([]string{result.Name, strings.Join(result.DependsOn, ", "), jobID, result.Status})
+		}
+		table.SetAlignment(tablewriter.ALIGN_LEFT)
+		table.Render()
+		return nil
+	})
+}
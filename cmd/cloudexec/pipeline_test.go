@@ -0,0 +1,151 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/crytic/cloudexec/pkg/state"
+)
+
+func TestPlanPipeline(t *testing.T) {
+	lcs := []LaunchConfig{
+		{ConfigName: "build", DependsOn: []string{"slither"}},
+		{ConfigName: "coverage", DependsOn: []string{"echidna", "build"}},
+		{ConfigName: "echidna", DependsOn: []string{"build"}},
+		{ConfigName: "lint"},
+		{ConfigName: "slither"},
+	}
+
+	var testTable = []struct {
+		name     string
+		names    []string
+		expected []string
+	}{
+		{"It should order every job after its dependencies", nil, []string{"slither", "build", "echidna", "coverage", "lint"}},
+		{"It should add the dependencies of the named jobs", []string{"echidna"}, []string{"slither", "build", "echidna"}},
+		{"It should run shared dependencies once", []string{"coverage", "build"}, []string{"slither", "build", "echidna", "coverage"}},
+	}
+	for _, tt := range testTable {
+		t.Run(tt.name, func(t *testing.T) {
+			stages, err := PlanPipeline(lcs, tt.names)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			names := []string{}
+			for _, stage := range stages {
+				names = append(names, stage.ConfigName)
+			}
+			if strings.Join(names, ",") != strings.Join(tt.expected, ",") {
+				t.Errorf("Expected %v, got %v", tt.expected, names)
+			}
+		})
+	}
+}
+
+func TestPlanPipelineErrors(t *testing.T) {
+	var testTable = []struct {
+		name     string
+		lcs      []LaunchConfig
+		names    []string
+		expected string
+	}{
+		{"It should reject unknown jobs", []LaunchConfig{{ConfigName: "build"}}, []string{"test"}, "Job test is not defined"},
+		{"It should reject unknown dependencies", []LaunchConfig{{ConfigName: "build", DependsOn: []string{"lint"}}}, nil, "Job build depends on lint, which is not defined"},
+		{"It should reject jobs that depend on themselves", []LaunchConfig{{ConfigName: "build", DependsOn: []string{"build"}}}, nil, "build -> build"},
+		{"It should reject cycles", []LaunchConfig{
+			{ConfigName: "a", DependsOn: []string{"b"}},
+			{ConfigName: "b", DependsOn: []string{"c"}},
+			{ConfigName: "c", DependsOn: []string{"a"}},
+		}, nil, "a -> b -> c -> a"},
+	}
+	for _, tt := range testTable {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := PlanPipeline(tt.lcs, tt.names)
+			if err == nil || !strings.Contains(err.Error(), tt.expected) {
+				t.Errorf("Expected an error containing '%s', got %v", tt.expected, err)
+			}
+		})
+	}
+}
+
+func TestLoadLaunchConfigsWithDependencies(t *testing.T) {
+	dir := t.TempDir()
+	write := func(content string) string {
+		launchConfigPath := filepath.Join(dir, "cloudexec.toml")
+		err := os.WriteFile(launchConfigPath, []byte(content), 0644)
+		if err != nil {
+			t.Fatalf("Failed to write launch config: %v", err)
+		}
+		return launchConfigPath
+	}
+
+	lcs, err := LoadLaunchConfigs(write(`
+[input]
+directory = "input"
+
+[jobs.build]
+commands = { run = "forge build" }
+
+[jobs.echidna]
+dependsOn = ["build"]
+commands = { run = "echidna deps/build" }
+`))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(lcs) != 2 || len(lcs[0].DependsOn) != 0 || strings.Join(lcs[1].DependsOn, ",") != "build" {
+		t.Errorf("Expected echidna to depend on build, got %+v", lcs)
+	}
+
+	_, err = LoadLaunchConfigs(write(`
+dependsOn = ["build"]
+
+[commands]
+run = "echidna ."
+`))
+	if err == nil || !strings.Contains(err.Error(), "[jobs.<name>]") {
+		t.Errorf("Expected an error for dependsOn without named jobs, got %v", err)
+	}
+
+	_, err = LoadLaunchConfigs(write(`
+[jobs.build]
+dependsOn = ["echidna"]
+
+[jobs.echidna]
+dependsOn = ["build"]
+`))
+	if err == nil || !strings.Contains(err.Error(), "cycle") {
+		t.Errorf("Expected an error for a dependency cycle, got %v", err)
+	}
+}
+
+func TestResolveDependencies(t *testing.T) {
+	s := &state.State{Jobs: []state.Job{
+		{ID: 1, Project: "token", ConfigName: "build", Status: state.Completed},
+		{ID: 2, Project: "vault", ConfigName: "build", Status: state.Completed},
+		{ID: 3, Project: "token", ConfigName: "build", Status: state.Failed},
+		{ID: 4, Project: "token", ConfigName: "slither", Status: state.Running},
+	}}
+
+	dependencies, err := ResolveDependencies(s, LaunchConfig{Project: "token", ConfigName: "echidna", DependsOn: []string{"build"}})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if dependencies["build"] != 1 {
+		t.Errorf("Expected the latest completed build of the project, got %v", dependencies)
+	}
+
+	_, err = ResolveDependencies(s, LaunchConfig{Project: "token", ConfigName: "echidna", DependsOn: []string{"slither"}})
+	if err == nil {
+		t.Errorf("Expected an error for a dependency that never completed")
+	}
+}
+
+func TestFormatDependencies(t *testing.T) {
+	formatted := FormatDependencies(map[string]int64{"slither": 4, "build": 12})
+	if formatted != "build:12 slither:4" {
+		t.Errorf("Expected sorted name:jobID pairs, got '%s'", formatted)
+	}
+}
@@ -11,12 +11,24 @@ import (
 	"github.com/crytic/cloudexec/pkg/s3"
 )
 
-func DownloadJobOutput(config config.Config, jobID int64, localPath string) error {
+// PullResult describes the files downloaded from a job's output
+type PullResult struct {
+	JobID int64    `json:"jobId"`
+	Path  string   `json:"path"`
+	Files []string `json:"files"`
+}
+
+func DownloadJobOutput(config config.Config, jobID int64, localPath string) (*PullResult, error) {
+	result := &PullResult{
+		JobID: jobID,
+		Path:  localPath,
+		Files: []string{},
+	}
 
 	bucketPrefix := fmt.Sprintf("job-%v/output", jobID)
 	objectKeys, err := s3.ListObjects(config, bucketPrefix)
 	if err != nil {
-		return fmt.Errorf("Failed to list bucket objects: %w", err)
+		return nil, fmt.Errorf("Failed to list bucket objects: %w", err)
 	}
 
 	var downloadObjects func(objectKeys []string, prefix string) error
@@ -50,6 +62,7 @@ func DownloadJobOutput(config config.Config, jobID int64, localPath string) erro
 					return fmt.Errorf("Failed to write object content to file: %w", err)
 				}
 
+				result.Files = append(result.Files, localFilePath)
 				log.Good("Downloaded %s to %s", objectKey, localFilePath)
 			}
 		}
@@ -61,7 +74,7 @@ func DownloadJobOutput(config config.Config, jobID int64, localPath string) erro
 
 	if len(objectKeys) == 0 && logErr != nil {
 		log.Info("No output or logs are available for job %v", jobID)
-		return nil
+		return result, nil
 	} else if len(objectKeys) == 0 {
 		log.Info("No output is available for job %v", jobID)
 	} else if logErr != nil {
@@ -72,7 +85,7 @@ func DownloadJobOutput(config config.Config, jobID int64, localPath string) erro
 	if _, err := os.Stat(localPath); os.IsNotExist(err) {
 		err = os.MkdirAll(localPath, 0755)
 		if err != nil {
-			return fmt.Errorf("Failed to create local directory at %s: %w", localPath, err)
+			return nil, fmt.Errorf("Failed to create local directory at %s: %w", localPath, err)
 		}
 	}
 
@@ -80,7 +93,7 @@ func DownloadJobOutput(config config.Config, jobID int64, localPath string) erro
 	if len(objectKeys) > 0 {
 		err = downloadObjects(objectKeys, bucketPrefix)
 		if err != nil {
-			return err
+			return nil, err
 		}
 	}
 
@@ -89,10 +102,11 @@ func DownloadJobOutput(config config.Config, jobID int64, localPath string) erro
 		localFilePath := filepath.Join(localPath, "cloudexec.log")
 		err = os.WriteFile(localFilePath, body, 0644)
 		if err != nil {
-			return fmt.Errorf("Failed to write object content to file: %w", err)
+			return nil, fmt.Errorf("Failed to write object content to file: %w", err)
 		}
+		result.Files = append(result.Files, localFilePath)
 		log.Good("Downloaded job %v logs to %s", jobID, localFilePath)
 	}
 
-	return nil
+	return result, nil
 }
@@ -15,16 +15,16 @@ import (
 func UploadDirectoryToSpaces(config config.Config, sourcePath string, destPath string) error {
 	log.Wait("Compressing and uploading contents of directory %s to bucket at %s", sourcePath, destPath)
 
-	// Compute the path for the zipped archive of sourcePath
-	zipFileName := "input.zip"
-	zipFilePath := filepath.Join(os.TempDir(), zipFileName)
-
-	// Create a file where we will write the zipped archive
-	zipFile, err := os.Create(zipFilePath)
+	// Create a file where we will write the zipped archive of sourcePath. Each call gets its own so that jobs
+	// provisioned in parallel don't overwrite each other's archive.
+	zipFile, err := os.CreateTemp("", "cloudexec-input-*.zip")
 	if err != nil {
 		return err
 	}
 	defer zipFile.Close()
+	zipFilePath := zipFile.Name()
+	zipFileName := filepath.Base(zipFilePath)
+	defer os.Remove(zipFilePath)
 
 	// Create a new zip writer
 	zipWriter := zip.NewWriter(zipFile)
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+
+	"github.com/crytic/cloudexec/pkg/log"
+	"github.com/crytic/cloudexec/pkg/ssh"
+	"github.com/crytic/cloudexec/pkg/state"
+)
+
+// JobSSHTarget returns how to reach a job's droplet over SSH, based on what's recorded in state
+func JobSSHTarget(job *state.Job) ssh.Target {
+	target := ssh.Target{
+		JobID:              job.ID,
+		IPAddress:          job.Droplet.IP,
+		User:               "root",
+		HostKeyFingerprint: job.HostKeyFingerprint,
+	}
+	// Jobs on existing servers run as the given user, on their own tmux socket and outside of cloud-init
+	if user, _, found := strings.Cut(job.Host, "@"); found {
+		target.User = user
+		target.TmuxSocket = "cloudexec"
+		target.LogFile = JobRemoteDir(job) + "/cloudexec.log"
+	}
+	return target
+}
+
+// ParsePortForwards parses a list of '<local>:<remote>' specs
+func ParsePortForwards(specs []string) ([]ssh.PortForward, error) {
+	forwards := make([]ssh.PortForward, 0, len(specs))
+	for _, spec := range specs {
+		forward, err := ssh.ParsePortForward(spec)
+		if err != nil {
+			return nil, err
+		}
+		forwards = append(forwards, forward)
+	}
+	return forwards, nil
+}
+
+// ForwardPortsUntilInterrupted forwards the given ports to a job's droplet until the user presses Ctrl-C
+func ForwardPortsUntilInterrupted(job *state.Job, forwards []ssh.PortForward) error {
+	forwarder, err := ssh.StartPortForwarding(JobSSHTarget(job), forwards)
+	if err != nil {
+		return err
+	}
+	defer forwarder.Close()
+	for _, forward := range forwards {
+		log.Good("Forwarding localhost:%d to port %d on job %v", forward.LocalPort, forward.RemotePort, job.ID)
+	}
+	log.Info("Press Ctrl-C to stop forwarding")
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	defer signal.Stop(interrupt)
+	<-interrupt
+	log.Info("Stopped forwarding")
+	return nil
+}
+
+// GetActiveJob returns the job with the given ID, or the latest job if the ID is 0, as long as its droplet is still up
+func GetActiveJob(existingState *state.State, jobID int64) (*state.Job, error) {
+	var targetJob *state.Job
+	if jobID == 0 {
+		targetJob = existingState.GetLatestJob()
+		if targetJob == nil {
+			return nil, fmt.Errorf("No jobs are available")
+		}
+	} else {
+		targetJob = existingState.GetJob(jobID)
+		if targetJob == nil {
+			return nil, fmt.Errorf("Job %v does not exist", jobID)
+		}
+	}
+	if targetJob.Status != state.Provisioning && targetJob.Status != state.Running {
+		return nil, fmt.Errorf("Job %v is %s, its droplet is no longer available", targetJob.ID, targetJob.Status)
+	}
+	if targetJob.Droplet.IP == "" {
+		return nil, fmt.Errorf("Job %v does not have a droplet yet", targetJob.ID)
+	}
+	return targetJob, nil
+}
+
+// ParseCopyArgs works out the direction of a copy, remote paths are prefixed with a colon eg ':/root/output'
+func ParseCopyArgs(source string, destination string) (upload bool, localPath string, remotePath string, err error) {
+	sourceIsRemote := strings.HasPrefix(source, ":")
+	destinationIsRemote := strings.HasPrefix(destination, ":")
+	switch {
+	case sourceIsRemote && destinationIsRemote:
+		return false, "", "", fmt.Errorf("Copying between two remote paths is not supported")
+	case sourceIsRemote:
+		remotePath = strings.TrimPrefix(source, ":")
+		localPath = destination
+	case destinationIsRemote:
+		upload = true
+		localPath = source
+		remotePath = strings.TrimPrefix(destination, ":")
+	default:
+		return false, "", "", fmt.Errorf("One of the paths must be remote, prefix it with a colon eg ':%s'", destination)
+	}
+	if localPath == "" {
+		return false, "", "", fmt.Errorf("Local path can't be empty")
+	}
+	// An empty remote path refers to the home directory, like with scp
+	if remotePath == "" {
+		remotePath = "."
+	}
+	return upload, localPath, remotePath, nil
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/crytic/cloudexec/pkg/ssh"
+)
+
+func TestParseCopyArgs(t *testing.T) {
+	var testTable = []struct {
+		name           string
+		source         string
+		destination    string
+		expectedUpload bool
+		expectedLocal  string
+		expectedRemote string
+		expectErr      bool
+	}{
+		{"It should download remote sources", ":/root/output", "./output", false, "./output", "/root/output", false},
+		{"It should upload to remote destinations", "./input", ":/root/input", true, "./input", "/root/input", false},
+		{"It should default to the remote home directory", "./input", ":", true, "./input", ".", false},
+		{"It should reject two local paths", "./a", "./b", false, "", "", true},
+		{"It should reject two remote paths", ":a", ":b", false, "", "", true},
+	}
+
+	for _, tt := range testTable {
+		t.Run(tt.name, func(t *testing.T) {
+			upload, localPath, remotePath, err := ParseCopyArgs(tt.source, tt.destination)
+			if tt.expectErr {
+				if err == nil {
+					t.Errorf("Expected an error but got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if upload != tt.expectedUpload || localPath != tt.expectedLocal || remotePath != tt.expectedRemote {
+				t.Errorf("Expected (%v, %s, %s), got (%v, %s, %s)", tt.expectedUpload, tt.expectedLocal, tt.expectedRemote, upload, localPath, remotePath)
+			}
+		})
+	}
+}
+
+func TestParsePortForwards(t *testing.T) {
+	forwards, err := ParsePortForwards([]string{"8080:8888", "3000"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(forwards) != 2 || forwards[0] != (ssh.PortForward{LocalPort: 8080, RemotePort: 8888}) || forwards[1] != (ssh.PortForward{LocalPort: 3000, RemotePort: 3000}) {
+		t.Errorf("Unexpected port forwards: %+v", forwards)
+	}
+	for _, spec := range []string{"", "abc", "8080:", "0:80", "80:70000"} {
+		_, err := ParsePortForwards([]string{spec})
+		if err == nil {
+			t.Errorf("Expected an error for %q but got none", spec)
+		}
+	}
+}
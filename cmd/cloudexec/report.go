@@ -0,0 +1,211 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/crytic/cloudexec/pkg/config"
+	"github.com/crytic/cloudexec/pkg/state"
+	"github.com/olekukonko/tablewriter"
+)
+
+// ReportGroupings lists the ways jobs can be grouped together in a report
+var ReportGroupings = []string{"user", "project", "size", "month"}
+
+// ReportJob is a job along with the user whose bucket it was found in
+type ReportJob struct {
+	Owner string
+	Job   state.Job
+}
+
+// ReportRow summarizes all jobs that share one value of a grouping, eg one month or one droplet size
+type ReportRow struct {
+	Group       string  `json:"group"`
+	Key         string  `json:"key"`
+	Jobs        int     `json:"jobs"`
+	Completed   int     `json:"completed"`
+	Failed      int     `json:"failed"`
+	Timedout    int     `json:"timedout"`
+	Cancelled   int     `json:"cancelled"`
+	Runtime     int64   `json:"runtime"` // seconds
+	Cost        float64 `json:"cost"`
+	SuccessRate float64 `json:"successRate"`
+}
+
+// CollectReportJobs gathers current jobs from the state file and cleaned jobs from the ledger of each user's bucket
+func CollectReportJobs(config config.Config, users []string) ([]ReportJob, error) {
+	var jobs []ReportJob
+	if len(users) == 0 {
+		users = []string{config.Username}
+	}
+	for _, user := range users {
+		// Each user has their own bucket, which is selected by username
+		userConfig := config
+		userConfig.Username = user
+		existingState, err := state.GetState(userConfig)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to get state of user %s: %w", user, err)
+		}
+		ledger, err := state.GetLedger(userConfig)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to get ledger of user %s: %w", user, err)
+		}
+		// Job IDs can be reused after a job is cleaned so they're identified by start time as well
+		seen := make(map[string]bool)
+		jobKey := func(job state.Job) string {
+			return fmt.Sprintf("%d-%d", job.ID, job.StartedAt)
+		}
+		for _, job := range existingState.Jobs {
+			seen[jobKey(job)] = true
+			jobs = append(jobs, ReportJob{Owner: user, Job: job})
+		}
+		for _, entry := range ledger.Entries {
+			if seen[jobKey(entry.Job)] {
+				continue
+			}
+			seen[jobKey(entry.Job)] = true
+			jobs = append(jobs, ReportJob{Owner: entry.Owner, Job: entry.Job})
+		}
+	}
+	return jobs, nil
+}
+
+// FilterReportJobs keeps only the jobs matching the query
+func FilterReportJobs(jobs []ReportJob, query state.JobQuery) []ReportJob {
+	now := time.Now()
+	filtered := []ReportJob{}
+	for _, rj := range jobs {
+		if query.Matches(rj.Job, now) {
+			filtered = append(filtered, rj)
+		}
+	}
+	return filtered
+}
+
+// reportKey returns the value of a job for the given grouping
+func reportKey(grouping string, rj ReportJob) string {
+	switch grouping {
+	case "user":
+		return rj.Owner
+	case "project":
+		return rj.Job.Project
+	case "size":
+		if rj.Job.Host != "" {
+			return "byo"
+		}
+		return rj.Job.Droplet.Size.Slug
+	case "month":
+		return time.Unix(rj.Job.StartedAt, 0).Format("2006-01")
+	}
+	return ""
+}
+
+// BuildReport aggregates jobs into one row per value of each requested grouping
+func BuildReport(jobs []ReportJob, groupings []string) ([]ReportRow, error) {
+	rows := []ReportRow{}
+	for _, grouping := range groupings {
+		isKnown := false
+		for _, known := range ReportGroupings {
+			isKnown = isKnown || known == grouping
+		}
+		if !isKnown {
+			return nil, fmt.Errorf("Unknown report grouping %s, expected one of %s", grouping, strings.Join(ReportGroupings, ", "))
+		}
+
+		// Tally up each job under its key for this grouping
+		rowsByKey := make(map[string]*ReportRow)
+		for _, rj := range jobs {
+			key := reportKey(grouping, rj)
+			if key == "" {
+				key = "unknown"
+			}
+			row, ok := rowsByKey[key]
+			if !ok {
+				row = &ReportRow{Group: grouping, Key: key}
+				rowsByKey[key] = row
+			}
+			row.Jobs++
+			row.Runtime += rj.Job.Runtime()
+			row.Cost += rj.Job.Cost()
+			switch rj.Job.Status {
+			case state.Completed:
+				row.Completed++
+			case state.Failed:
+				row.Failed++
+			case state.Timedout:
+				row.Timedout++
+			case state.Cancelled:
+				row.Cancelled++
+			}
+		}
+
+		// Success rate only considers jobs that have finished
+		keys := make([]string, 0, len(rowsByKey))
+		for key, row := range rowsByKey {
+			finished := row.Completed + row.Failed + row.Timedout + row.Cancelled
+			if finished > 0 {
+				row.SuccessRate = float64(row.Completed) / float64(finished)
+			}
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			rows = append(rows, *rowsByKey[key])
+		}
+	}
+	return rows, nil
+}
+
+// PrintReport writes report rows to stdout as a table, CSV, JSON or YAML
+func PrintReport(rows []ReportRow, format string) error {
+	header := []string{"Group", "Key", "Jobs", "Completed", "Failed", "Timed Out", "Cancelled", "Runtime (hours)", "Cost", "Success Rate"}
+	formatRow := func(row ReportRow) []string {
+		return []string{
+			row.Group,
+			row.Key,
+			strconv.Itoa(row.Jobs),
+			strconv.Itoa(row.Completed),
+			strconv.Itoa(row.Failed),
+			strconv.Itoa(row.Timedout),
+			strconv.Itoa(row.Cancelled),
+			strconv.FormatFloat(float64(row.Runtime)/float64(3600), 'f', 2, 64),
+			strconv.FormatFloat(row.Cost, 'f', 4, 64),
+			strconv.FormatFloat(row.SuccessRate*100, 'f', 1, 64) + "%",
+		}
+	}
+
+	switch format {
+	case TableOutput:
+		table := tablewriter.NewWriter(os.Stdout)
+		table.SetHeader(header)
+		for _, row := range rows {
+			table.Append(formatRow(row))
+		}
+		table.SetAlignment(tablewriter.ALIGN_LEFT)
+		table.Render()
+	case "csv":
+		writer := csv.NewWriter(os.Stdout)
+		err := writer.Write(header)
+		if err != nil {
+			return fmt.Errorf("Failed to write CSV header: %w", err)
+		}
+		for _, row := range rows {
+			err = writer.Write(formatRow(row))
+			if err != nil {
+				return fmt.Errorf("Failed to write CSV row: %w", err)
+			}
+		}
+		writer.Flush()
+		return writer.Error()
+	case JSONOutput, YAMLOutput:
+		return WriteStructured(os.Stdout, format, rows)
+	default:
+		return fmt.Errorf("Unknown report format %s, expected one of table, csv, json, yaml", format)
+	}
+	return nil
+}
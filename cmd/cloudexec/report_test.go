@@ -0,0 +1,57 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	do "github.com/crytic/cloudexec/pkg/digitalocean"
+	"github.com/crytic/cloudexec/pkg/state"
+)
+
+func getReportJob(owner string, size string, status state.JobStatus, hours int64) ReportJob {
+	startedAt := time.Date(2024, time.March, 1, 0, 0, 0, 0, time.Local).Unix()
+	return ReportJob{
+		Owner: owner,
+		Job: state.Job{
+			Project:     "fuzzing",
+			StartedAt:   startedAt,
+			CompletedAt: startedAt + hours*3600,
+			Status:      status,
+			Droplet: do.Droplet{
+				Size: do.Size{Slug: size, HourlyCost: 0.5},
+			},
+		},
+	}
+}
+
+func TestBuildReport(t *testing.T) {
+	jobs := []ReportJob{
+		getReportJob("alice", "c-2", state.Completed, 2),
+		getReportJob("alice", "c-4", state.Failed, 1),
+		getReportJob("bob", "c-2", state.Completed, 4),
+	}
+
+	rows, err := BuildReport(jobs, []string{"user", "month"})
+	if err != nil {
+		t.Fatalf("Failed to build report: %v", err)
+	}
+
+	expected := []ReportRow{
+		{Group: "user", Key: "alice", Jobs: 2, Completed: 1, Failed: 1, Runtime: 3 * 3600, Cost: 1.5, SuccessRate: 0.5},
+		{Group: "user", Key: "bob", Jobs: 1, Completed: 1, Runtime: 4 * 3600, Cost: 2, SuccessRate: 1},
+		{Group: "month", Key: "2024-03", Jobs: 3, Completed: 2, Failed: 1, Runtime: 7 * 3600, Cost: 3.5, SuccessRate: 2.0 / 3.0},
+	}
+	if len(rows) != len(expected) {
+		t.Fatalf("Expected %d rows, got %d: %+v", len(expected), len(rows), rows)
+	}
+	for i, row := range rows {
+		if row != expected[i] {
+			t.Errorf("Expected row %d to be %+v, got %+v", i, expected[i], row)
+		}
+	}
+
+	_, err = BuildReport(jobs, []string{"weekday"})
+	if err == nil {
+		t.Errorf("Expected an error for an unknown grouping")
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Reasons a failed attempt can be retried for, listed in retryOn
+const (
+	// The setup commands failed
+	RetrySetupFailure = "setup-failure"
+	// The droplet couldn't be created or reached, or it couldn't download the job's input
+	RetryProviderError = "provider-error"
+	// The run command exited with a given code, eg exit-code:1
+	retryExitCodePrefix = "exit-code:"
+)
+
+// Reasons retried if retries is set without retryOn, exit codes are only retried if asked for
+var defaultRetryOn = []string{RetrySetupFailure, RetryProviderError}
+
+// RetryPolicy is how many times a job is retried and for which reasons
+type RetryPolicy struct {
+	Retries int
+	RetryOn []string
+}
+
+// ParseRetryPolicy validates the retries and retryOn settings of a launch config
+func ParseRetryPolicy(input Input) (RetryPolicy, error) {
+	policy := RetryPolicy{Retries: input.Retries}
+	if input.Retries < 0 {
+		return policy, fmt.Errorf("The number of retries can't be negative, got %d", input.Retries)
+	}
+	if input.Retries == 0 {
+		if len(input.RetryOn) > 0 {
+			return policy, fmt.Errorf("retryOn is set but retries isn't, set retries to how many times to retry the job")
+		}
+		return policy, nil
+	}
+	policy.RetryOn = input.RetryOn
+	if len(policy.RetryOn) == 0 {
+		policy.RetryOn = defaultRetryOn
+	}
+	for _, reason := range policy.RetryOn {
+		if reason == RetrySetupFailure || reason == RetryProviderError {
+			continue
+		}
+		code, found := strings.CutPrefix(reason, retryExitCodePrefix)
+		if !found {
+			return policy, fmt.Errorf("Unknown retryOn reason %s, expected %s, %s or %sN", reason, RetrySetupFailure, RetryProviderError, retryExitCodePrefix)
+		}
+		exitCode, err := strconv.Atoi(code)
+		if err != nil || exitCode < 1 || exitCode > 255 {
+			return policy, fmt.Errorf("Invalid retryOn reason %s, the exit code must be between 1 and 255", reason)
+		}
+	}
+	return policy, nil
+}
+
+// RetriesOn returns true if attempts that failed for the given reason are retried
+func (p RetryPolicy) RetriesOn(reason string) bool {
+	if p.Retries == 0 {
+		return false
+	}
+	for _, retryOn := range p.RetryOn {
+		if retryOn == reason {
+			return true
+		}
+	}
+	return false
+}
+
+// RetriesExitCodes returns true if the run command is retried for any exit code
+func (p RetryPolicy) RetriesExitCodes() bool {
+	if p.Retries == 0 {
+		return false
+	}
+	for _, reason := range p.RetryOn {
+		if strings.HasPrefix(reason, retryExitCodePrefix) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseRetryPolicy(t *testing.T) {
+	policy, err := ParseRetryPolicy(Input{})
+	if err != nil || policy.RetriesOn(RetrySetupFailure) {
+		t.Errorf("Jobs shouldn't be retried by default, got %+v, %v", policy, err)
+	}
+
+	policy, err = ParseRetryPolicy(Input{Retries: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(policy.RetryOn, defaultRetryOn) || policy.RetriesExitCodes() {
+		t.Errorf("Expected only transient failures to be retried by default, got %+v", policy)
+	}
+
+	policy, err = ParseRetryPolicy(Input{Retries: 1, RetryOn: []string{"exit-code:3"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !policy.RetriesOn("exit-code:3") || policy.RetriesOn("exit-code:1") || policy.RetriesOn(RetrySetupFailure) || !policy.RetriesExitCodes() {
+		t.Errorf("Unexpected retry policy %+v", policy)
+	}
+
+	for _, input := range []Input{
+		{Retries: -1},
+		{RetryOn: []string{RetrySetupFailure}},
+		{Retries: 1, RetryOn: []string{"timeout"}},
+		{Retries: 1, RetryOn: []string{"exit-code:0"}},
+		{Retries: 1, RetryOn: []string{"exit-code:any"}},
+	} {
+		if _, err := ParseRetryPolicy(input); err == nil {
+			t.Errorf("Expected an error parsing %+v", input)
+		}
+	}
+}
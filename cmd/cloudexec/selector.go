@@ -0,0 +1,119 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/crytic/cloudexec/pkg/log"
+	"github.com/crytic/cloudexec/pkg/state"
+	"github.com/urfave/cli/v2"
+)
+
+// JobSelectorFlags returns the flags used by every command that operates on a selection of jobs
+func JobSelectorFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringFlag{
+			Name:  "job",
+			Usage: "Job IDs to select, eg 3 or 3,5-9",
+		},
+		&cli.StringSliceFlag{
+			Name:  "status",
+			Usage: "Select jobs with this status, can be repeated",
+		},
+		&cli.StringFlag{
+			Name:  "name",
+			Usage: "Select jobs whose name matches this pattern, eg 'medusa*'",
+		},
+		&cli.StringFlag{
+			Name:  "older-than",
+			Usage: "Select jobs started at least this long ago, eg 12h, 7d or 2w",
+		},
+		&cli.StringSliceFlag{
+			Name:  "label",
+			Usage: "Select jobs with this key=value label, can be repeated",
+		},
+		&cli.Int64Flag{
+			Name:  "sweep",
+			Usage: "Select the jobs of a sweep launched from a matrix",
+		},
+		&cli.Int64Flag{
+			Name:  "pipeline",
+			Usage: "Select the jobs launched by a pipeline",
+		},
+		&cli.BoolFlag{
+			Name:  "all",
+			Usage: "Select all jobs",
+		},
+		&cli.BoolFlag{
+			Name:  "dry-run",
+			Usage: "Show the selected jobs without doing anything to them",
+		},
+	}
+}
+
+// JobQueryFromFlags builds a job query from the selector flags
+func JobQueryFromFlags(c *cli.Context) (state.JobQuery, error) {
+	var query state.JobQuery
+	var err error
+	if c.String("job") != "" {
+		query.IDs, err = state.ParseJobIDs(c.String("job"))
+		if err != nil {
+			return query, err
+		}
+	}
+	for _, name := range c.StringSlice("status") {
+		status, err := state.ParseJobStatus(name)
+		if err != nil {
+			return query, err
+		}
+		query.Statuses = append(query.Statuses, status)
+	}
+	if c.String("name") != "" {
+		err = state.ValidateNamePattern(c.String("name"))
+		if err != nil {
+			return query, err
+		}
+		query.NamePattern = c.String("name")
+	}
+	if c.String("older-than") != "" {
+		query.OlderThan, err = state.ParseAge(c.String("older-than"))
+		if err != nil {
+			return query, err
+		}
+	}
+	if len(c.StringSlice("label")) > 0 {
+		query.Labels, err = state.ParseLabels(c.StringSlice("label"))
+		if err != nil {
+			return query, err
+		}
+	}
+	query.SweepID = c.Int64("sweep")
+	query.PipelineID = c.Int64("pipeline")
+	query.All = c.Bool("all")
+	return query, nil
+}
+
+// SelectJobs returns the jobs chosen by the selector flags, or the command's default jobs if none were given.
+// If --dry-run is set, the jobs are printed and nil is returned so the caller does nothing.
+func SelectJobs(c *cli.Context, existingState *state.State, defaultJobs func() ([]state.Job, error)) ([]state.Job, error) {
+	query, err := JobQueryFromFlags(c)
+	if err != nil {
+		return nil, err
+	}
+	var jobs []state.Job
+	if query.IsEmpty() {
+		jobs, err = defaultJobs()
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		jobs = existingState.Query(query)
+		if len(jobs) == 0 {
+			return nil, fmt.Errorf("No jobs match the given selection")
+		}
+	}
+	if c.Bool("dry-run") {
+		log.Info("The following %d job(s) would be affected:", len(jobs))
+		return nil, PrintJobs(jobs)
+	}
+	return jobs, nil
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/crytic/cloudexec/pkg/config"
+	do "github.com/crytic/cloudexec/pkg/digitalocean"
+	"github.com/olekukonko/tablewriter"
+)
+
+// PrintSizes lists the droplet sizes that can be launched, optionally limited to a single region
+func PrintSizes(config config.Config, region string) error {
+	specs, err := do.ListSizes(config)
+	if err != nil {
+		return err
+	}
+
+	// Only show sizes that can actually be launched, cheapest first
+	available := []do.SizeSpec{}
+	for _, spec := range specs {
+		if !spec.Available || (region != "" && !spec.AvailableIn(region)) {
+			continue
+		}
+		available = append(available, spec)
+	}
+	sort.SliceStable(available, func(i, j int) bool {
+		return available[i].HourlyCost < available[j].HourlyCost
+	})
+
+	return PrintOutput(available, func() error {
+		printSizesTable(available)
+		return nil
+	})
+}
+
+// printSizesTable renders droplet sizes for humans using tablewriter
+func printSizesTable(available []do.SizeSpec) {
+	formatInt := func(i int64) string {
+		return strconv.Itoa(int(i))
+	}
+
+	formatFloat := func(f float64) string {
+		return strconv.FormatFloat(f, 'f', 4, 64)
+	}
+
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader([]string{"Size", "Description", "CPUs", "Memory", "Disk", "Hourly Cost", "Monthly Cost", "Regions"})
+	for _, spec := range available {
+		table.Append([]string{
+			spec.Slug,
+			spec.Description,
+			formatInt(spec.CPUs),
+			formatInt(spec.Memory) + " MB",
+			formatInt(spec.Disk) + " GB",
+			"$" + formatFloat(spec.HourlyCost),
+			"$" + strconv.FormatFloat(spec.MonthlyCost, 'f', 2, 64),
+			strings.Join(spec.Regions, " "),
+		})
+	}
+	table.SetAlignment(tablewriter.ALIGN_LEFT)
+	table.Render()
+}
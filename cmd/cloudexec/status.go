@@ -11,15 +11,65 @@ import (
 	"github.com/olekukonko/tablewriter"
 )
 
-func PrintStatus(config config.Config, showAll bool) error {
+// StatusEntry is a job as shown by the status command, along with its runtime and cost so far
+type StatusEntry struct {
+	state.Job
+	Runtime   int64   `json:"runtime"` // seconds
+	TotalCost float64 `json:"total_cost"`
+	// Seconds until the run command times out, only set for running jobs
+	TimeLeft int64 `json:"time_left,omitempty"`
+}
+
+// PrintStatus prints the running jobs and the latest job, or all jobs if showAll is set, that match the filter
+func PrintStatus(config config.Config, showAll bool, filter state.JobQuery) error {
 	existingState, err := state.GetState(config)
 	if err != nil {
 		return err
 	}
 
+	// Find the latest job to use as the default display
+	latestJob := existingState.GetLatestJob()
+
+	now := time.Now()
+	jobs := []state.Job{}
+	for _, job := range existingState.Jobs {
+		if !filter.Matches(job, now) {
+			continue
+		}
+		if showAll || (job.Status == state.Running || job.Status == state.Provisioning) || (latestJob != nil && job.ID == latestJob.ID) {
+			jobs = append(jobs, job)
+		}
+	}
+
+	return PrintJobs(jobs)
+}
+
+// PrintJobs prints jobs in the same format as the status command
+func PrintJobs(jobs []state.Job) error {
+	entries := []StatusEntry{}
+	now := time.Now().Unix()
+	for _, job := range jobs {
+		entry := StatusEntry{
+			Job:       job,
+			Runtime:   job.Runtime(),
+			TotalCost: job.Cost(),
+		}
+		if job.Status == state.Running && job.Deadline > now {
+			entry.TimeLeft = job.Deadline - now
+		}
+		entries = append(entries, entry)
+	}
+	return PrintOutput(entries, func() error {
+		printStatusTable(entries)
+		return nil
+	})
+}
+
+// printStatusTable renders jobs for humans using tablewriter
+func printStatusTable(entries []StatusEntry) {
 	// Print the status of each job using tablewriter
 	table := tablewriter.NewWriter(os.Stdout)
-	table.SetHeader([]string{"Job ID", "Job Name", "Status", "Droplet IP", "Memory", "CPUs", "Disk", "Started At", "Updated At", "Time Elapsed", "Hourly Cost", "Total Cost"})
+	table.SetHeader([]string{"Job ID", "Job Name", "Status", "Droplet IP", "Memory", "CPUs", "Disk", "Started At", "Updated At", "Time Elapsed", "Time Left", "Hourly Cost", "Total Cost"})
 
 	formatDate := func(timestamp int64) string {
 		if timestamp == 0 {
@@ -57,41 +107,41 @@ func PrintStatus(config config.Config, showAll bool) error {
 		return strconv.FormatFloat(f, 'f', 4, 64)
 	}
 
-	// Find the latest job to use as the default display
-	latestJob := existingState.GetLatestJob()
-
-	for _, job := range existingState.Jobs {
-		if showAll || (job.Status == state.Running || job.Status == state.Provisioning) || (latestJob != nil && job.ID == latestJob.ID) {
-
-			latestUpdate := func() int64 {
-				if job.CompletedAt == 0 {
-					return job.UpdatedAt
-				}
-				return job.CompletedAt
-			}()
-			elapsedTime := int64(latestUpdate - job.StartedAt)
-			totalCost := float64(elapsedTime) / float64(3600) * job.Droplet.Size.HourlyCost
-
-			table.Append([]string{
-				strconv.Itoa(int(job.ID)),
-				job.Name,
-				string(job.Status),
-				job.Droplet.IP,
-				formatInt(job.Droplet.Size.Memory) + " MB",
-				formatInt(job.Droplet.Size.CPUs),
-				formatInt(job.Droplet.Size.Disk) + " GB",
-				formatDate(job.StartedAt),
-				formatDate(job.UpdatedAt),
-				formatElapsedTime(elapsedTime),
-				"$" + formatFloat(job.Droplet.Size.HourlyCost),
-				"$" + formatFloat(totalCost),
-			})
-
+	for _, entry := range entries {
+		job := entry.Job
+		status := string(job.Status)
+		if job.Attempt > 1 {
+			status = fmt.Sprintf("%s (attempt %d/%d)", job.Status, job.Attempt, job.Retries+1)
+		}
+		timeLeft := ""
+		if entry.TimeLeft > 0 {
+			timeLeft = formatElapsedTime(entry.TimeLeft)
 		}
+		table.Append([]string{
+			strconv.Itoa(int(job.ID)),
+			job.Name,
+			status,
+			job.Droplet.IP,
+			formatInt(job.Droplet.Size.Memory) + " MB",
+			formatInt(job.Droplet.Size.CPUs),
+			formatInt(job.Droplet.Size.Disk) + " GB",
+			formatDate(job.StartedAt),
+			formatDate(job.UpdatedAt),
+			formatElapsedTime(entry.Runtime),
+			timeLeft,
+			"$" + formatFloat(job.Droplet.Size.HourlyCost),
+			"$" + formatFloat(entry.TotalCost),
+		})
 	}
 
 	table.SetAlignment(tablewriter.ALIGN_LEFT)
 	table.SetRowLine(true)
 	table.Render()
-	return nil
+
+	// List the failed attempts of retried jobs below the table
+	for _, entry := range entries {
+		for _, attempt := range entry.Attempts {
+			fmt.Printf("Job %v attempt %d failed after %s: %s\n", entry.ID, attempt.Number, formatElapsedTime(attempt.EndedAt-attempt.StartedAt), attempt.Reason)
+		}
+	}
 }
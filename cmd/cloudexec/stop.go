@@ -0,0 +1,139 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/crytic/cloudexec/pkg/config"
+	"github.com/crytic/cloudexec/pkg/log"
+	"github.com/crytic/cloudexec/pkg/ssh"
+	"github.com/crytic/cloudexec/pkg/state"
+)
+
+const (
+	// How long the workload has to exit after being interrupted, unless --grace-period is given
+	DefaultStopGracePeriod = 5 * time.Minute
+	// Time allowed on top of the grace period for the droplet to upload output and logs and destroy itself
+	stopUploadAllowance = 5 * time.Minute
+	stopPollInterval    = 10 * time.Second
+)
+
+// StopJobs stops running jobs gracefully. The workload is sent SIGINT and given the grace period to exit, then
+// the droplet uploads its output and logs, marks the job as cancelled and destroys itself. Droplets that can't
+// be reached or don't finish in time are destroyed outright, as by cancel.
+func StopJobs(config config.Config, existingState *state.State, jobs []state.Job, gracePeriod time.Duration, force bool) error {
+	if gracePeriod <= 0 {
+		return fmt.Errorf("The grace period must be positive, got %s", gracePeriod)
+	}
+	failed := 0
+	stopping := []int64{}
+	for i := range jobs {
+		job := &jobs[i]
+		if job.IsFinished() {
+			log.Info("Job %v is not running, it is %s", job.ID, job.Status)
+			continue
+		}
+		log.Warn("Stopping job %v, its workload has %s to exit before droplet %s is destroyed", job.ID, gracePeriod, job.Droplet.Name)
+		if !force { // Ask for confirmation before stopping this job if no force flag
+			log.Prompt("Confirm? (y/n)")
+			var response string
+			fmt.Scanln(&response)
+			if strings.ToLower(response) != "y" {
+				log.Info("Job %v was not stopped", job.ID)
+				continue
+			}
+		}
+		err := requestStop(job, gracePeriod)
+		if err == nil {
+			stopping = append(stopping, job.ID)
+			continue
+		}
+		log.Warn("Failed to stop job %v gracefully, destroying its droplet instead: %v", job.ID, err)
+		err = destroyJob(config, existingState, job)
+		if err != nil {
+			log.Error("Failed to cancel job %v: %v", job.ID, err)
+			failed++
+		}
+	}
+
+	if len(stopping) > 0 {
+		failed += waitForStop(config, stopping, time.Now().Add(gracePeriod+stopUploadAllowance))
+	}
+	if failed > 0 {
+		return fmt.Errorf("Failed to stop %d of %d job(s)", failed, len(jobs))
+	}
+	return nil
+}
+
+// requestStop asks a job's droplet to interrupt its workload, using a script the droplet installed at boot
+func requestStop(job *state.Job, gracePeriod time.Duration) error {
+	if job.Droplet.IP == "" {
+		return fmt.Errorf("Job %v does not have a droplet yet", job.ID)
+	}
+	log.Info("Interrupting job %v...", job.ID)
+	exitCode, err := ssh.RunCommand(JobSSHTarget(job), fmt.Sprintf("bash %s/stop.sh %d", JobRemoteDir(job), int64(gracePeriod.Seconds())))
+	if err != nil {
+		return err
+	}
+	if exitCode != 0 {
+		return fmt.Errorf("Stop script exited with code %d", exitCode)
+	}
+	return nil
+}
+
+// waitForStop waits until the droplets of the given jobs have uploaded their results and marked them as
+// finished, destroying any that are still running at the deadline. It returns the number of jobs that couldn't
+// be stopped or whose results couldn't be uploaded.
+func waitForStop(config config.Config, jobIDs []int64, deadline time.Time) int {
+	log.Wait("Waiting for %d job(s) to upload their output and logs", len(jobIDs))
+	pending := jobIDs
+	failedUploads := 0
+	for {
+		time.Sleep(stopPollInterval)
+		currentState, err := state.GetState(config)
+		if err != nil {
+			log.Warn("Failed to check on the stopping jobs: %v", err)
+			if time.Now().Before(deadline) {
+				continue
+			}
+			return len(pending) + failedUploads
+		}
+		stillRunning := []int64{}
+		for _, jobID := range pending {
+			job := currentState.GetJob(jobID)
+			if job == nil {
+				// Removed from the state by someone else, eg with clean
+				continue
+			}
+			if job.IsFinished() {
+				if job.UploadFailed {
+					log.Error("Job %v stopped but its droplet failed to upload its output or logs, some of its results may be missing", jobID)
+					failedUploads++
+					continue
+				}
+				log.Good("Job %v stopped, it is %s", jobID, job.Status)
+				continue
+			}
+			stillRunning = append(stillRunning, jobID)
+		}
+		pending = stillRunning
+		if len(pending) == 0 {
+			return failedUploads
+		}
+		if time.Now().Before(deadline) {
+			continue
+		}
+
+		failed := failedUploads
+		for _, jobID := range pending {
+			log.Warn("Job %v didn't finish stopping in time, destroying its droplet", jobID)
+			err = destroyJob(config, currentState, currentState.GetJob(jobID))
+			if err != nil {
+				log.Error("Failed to cancel job %v: %v", jobID, err)
+				failed++
+			}
+		}
+		return failed
+	}
+}
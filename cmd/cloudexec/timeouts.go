@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+const (
+	// How long setup may take when working out the default maximum lifetime if no setupTimeout is given
+	defaultSetupAllowance = 5 * time.Hour
+	// Time allowed on top of setup and the run timeout for booting the droplet and uploading results
+	lifetimeMargin = time.Hour
+)
+
+// JobTimeouts are the limits on how long a job may take, from the [input] section of its launch config
+type JobTimeouts struct {
+	Timeout time.Duration
+	// Zero means the setup commands may take as long as the maximum lifetime allows
+	SetupTimeout time.Duration
+	MaxLifetime  time.Duration
+	// Zero means the job isn't stopped for being idle
+	IdleTimeout time.Duration
+}
+
+// ParseTimeouts parses the timeouts of a launch config. If no maximum lifetime is given, it's long enough
+// for setup, the run timeout, any retries and some margin, so a stuck droplet is always destroyed eventually.
+func ParseTimeouts(input Input) (JobTimeouts, error) {
+	var timeouts JobTimeouts
+	var err error
+	timeouts.Timeout, err = time.ParseDuration(input.Timeout)
+	if err != nil {
+		return timeouts, fmt.Errorf("Failed to parse timeout of %s: %w", input.Timeout, err)
+	}
+	for _, optional := range []struct {
+		name     string
+		value    string
+		duration *time.Duration
+	}{
+		{"setupTimeout", input.SetupTimeout, &timeouts.SetupTimeout},
+		{"maxLifetime", input.MaxLifetime, &timeouts.MaxLifetime},
+		{"idleTimeout", input.IdleTimeout, &timeouts.IdleTimeout},
+	} {
+		if optional.value == "" {
+			continue
+		}
+		*optional.duration, err = time.ParseDuration(optional.value)
+		if err != nil {
+			return timeouts, fmt.Errorf("Failed to parse %s of %s: %w", optional.name, optional.value, err)
+		}
+		if *optional.duration <= 0 {
+			return timeouts, fmt.Errorf("The %s must be positive, got %s", optional.name, optional.value)
+		}
+	}
+
+	if timeouts.MaxLifetime == 0 {
+		setupAllowance := timeouts.SetupTimeout
+		if setupAllowance == 0 {
+			setupAllowance = defaultSetupAllowance
+		}
+		// Retries happen on the same droplet, leave room for the longest attempt that can be retried
+		policy, err := ParseRetryPolicy(input)
+		if err != nil {
+			return timeouts, err
+		}
+		var retryAllowance time.Duration
+		if policy.RetriesOn(RetrySetupFailure) {
+			retryAllowance = setupAllowance
+		}
+		if policy.RetriesExitCodes() && timeouts.Timeout > retryAllowance {
+			retryAllowance = timeouts.Timeout
+		}
+		timeouts.MaxLifetime = setupAllowance + timeouts.Timeout + time.Duration(policy.Retries)*retryAllowance + lifetimeMargin
+	}
+	return timeouts, nil
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseTimeouts(t *testing.T) {
+	tests := []struct {
+		name  string
+		input Input
+		want  JobTimeouts
+	}{
+		{
+			"Only a timeout gets a default lifetime",
+			Input{Timeout: "10h"},
+			JobTimeouts{Timeout: 10 * time.Hour, MaxLifetime: 16 * time.Hour},
+		},
+		{
+			"The default lifetime allows for the setup timeout",
+			Input{Timeout: "10h", SetupTimeout: "30m", IdleTimeout: "1h"},
+			JobTimeouts{Timeout: 10 * time.Hour, SetupTimeout: 30 * time.Minute, MaxLifetime: 11*time.Hour + 30*time.Minute, IdleTimeout: time.Hour},
+		},
+		{
+			"The default lifetime allows for retried setups",
+			Input{Timeout: "10h", SetupTimeout: "1h", Retries: 2},
+			JobTimeouts{Timeout: 10 * time.Hour, SetupTimeout: time.Hour, MaxLifetime: 14 * time.Hour},
+		},
+		{
+			"The default lifetime allows for retried runs",
+			Input{Timeout: "10h", SetupTimeout: "1h", Retries: 2, RetryOn: []string{"setup-failure", "exit-code:1"}},
+			JobTimeouts{Timeout: 10 * time.Hour, SetupTimeout: time.Hour, MaxLifetime: 32 * time.Hour},
+		},
+		{
+			"An explicit lifetime is kept",
+			Input{Timeout: "10h", MaxLifetime: "12h"},
+			JobTimeouts{Timeout: 10 * time.Hour, MaxLifetime: 12 * time.Hour},
+		},
+	}
+	for _, test := range tests {
+		got, err := ParseTimeouts(test.input)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("%s: got %+v, want %+v", test.name, got, test.want)
+		}
+	}
+
+	for _, input := range []Input{
+		{Timeout: ""},
+		{Timeout: "1h", SetupTimeout: "soon"},
+		{Timeout: "1h", IdleTimeout: "-5m"},
+		{Timeout: "1h", MaxLifetime: "0s"},
+	} {
+		if _, err := ParseTimeouts(input); err == nil {
+			t.Errorf("Expected an error parsing %+v", input)
+		}
+	}
+}
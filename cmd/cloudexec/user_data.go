@@ -9,6 +9,7 @@ import (
 	"time"
 
 	"github.com/crytic/cloudexec/pkg/config"
+	"github.com/crytic/cloudexec/pkg/ssh"
 )
 
 type UserData struct {
@@ -19,23 +20,82 @@ type UserData struct {
 	SetupCommands     string
 	RunCommand        string
 	Timeout           string
-	InputDirectory    string
+	SetupTimeout      string
+	MaxLifetime       string
+	IdleTimeout       string
+	// How many times the droplet retries the job, for which space separated reasons, and which attempt it starts at
+	Retries        int
+	RetryOn        string
+	Attempt        int
+	InputDirectory string
+	HostPrivateKey string
+	HostPublicKey  string
+	// Whether the client will send env vars over SSH once the droplet is up
+	WaitForEnv bool
+	EnvFile    string
+	// Space separated paths to checkpoint every CheckpointInterval seconds
+	CheckpointPaths    string
+	CheckpointInterval string
+	// Job whose checkpoint to restore, and how long it had run for, when resuming a job
+	RestoreJobID  int64
+	RunTimeOffset int64
+	// Space separated name:jobID pairs of the jobs whose output is downloaded into deps/<name>
+	Dependencies string
+	// Set when the job runs on an existing server rather than on its own droplet, which has no tags to read
+	// the job from and whose authorized key for the job is removed once it's done
+	OnHost               bool
+	JobID                int64
+	Username             string
+	AuthorizedKeyComment string
+	// Directory the job runs in on an existing server, relative to the home directory
+	Workspace string
 }
 
 //go:embed user_data.sh.tmpl
 var userDataTemplate string
 
-func GenerateUserData(config config.Config, lc LaunchConfig) (string, error) {
-	// Load the embeded user data template
-	tmpl := template.Must(template.New("user_data").Parse(userDataTemplate))
+func GenerateUserData(config config.Config, lc LaunchConfig, hostKey ssh.HostKey, waitForEnv bool, attempt int) (string, error) {
+	data, err := newUserData(config, lc, hostKey, waitForEnv, attempt)
+	if err != nil {
+		return "", err
+	}
+	return renderUserData(data)
+}
 
-	// turn the time duration string from config into a number of seconds
-	timeout, err := time.ParseDuration(lc.Input.Timeout)
+// GenerateHostScript generates the script that runs a job on an existing server. It's the same script as a
+// droplet's user data, minus the parts that set up and destroy the droplet.
+func GenerateHostScript(config config.Config, lc LaunchConfig, jobID int64, waitForEnv bool) (string, error) {
+	data, err := newUserData(config, lc, ssh.HostKey{}, waitForEnv, 1)
 	if err != nil {
-		return "", fmt.Errorf("Failed to parse timeout of %s: %w", lc.Input.Timeout, err)
+		return "", err
 	}
+	// The server has no droplet to destroy, so it doesn't get the DigitalOcean token
+	data.DigitalOceanToken = ""
+	data.OnHost = true
+	data.JobID = jobID
+	data.Username = config.Username
+	data.AuthorizedKeyComment = ssh.HostAlias(jobID)
+	data.Workspace = HostWorkspace(jobID)
+	return renderUserData(data)
+}
 
-	timeoutStr := fmt.Sprintf("%d", int(timeout.Seconds()))
+func newUserData(config config.Config, lc LaunchConfig, hostKey ssh.HostKey, waitForEnv bool, attempt int) (UserData, error) {
+	// turn the time duration strings from config into numbers of seconds
+	timeouts, err := ParseTimeouts(lc.Input)
+	if err != nil {
+		return UserData{}, err
+	}
+	policy, err := ParseRetryPolicy(lc.Input)
+	if err != nil {
+		return UserData{}, err
+	}
+	checkpointInterval, err := ParseCheckpointInterval(lc.Checkpoint)
+	if err != nil {
+		return UserData{}, err
+	}
+	seconds := func(d time.Duration) string {
+		return fmt.Sprintf("%d", int(d.Seconds()))
+	}
 
 	// Set the values for the template
 	// double quotes are escaped so the command strings can be safely contained by double quotes in bash
@@ -46,13 +106,41 @@ func GenerateUserData(config config.Config, lc LaunchConfig) (string, error) {
 		DigitalOceanToken: config.DigitalOcean.ApiKey,
 		SetupCommands:     strings.ReplaceAll(lc.Commands.Setup, `"`, `\"`),
 		RunCommand:        strings.ReplaceAll(lc.Commands.Run, `"`, `\"`),
-		Timeout:           timeoutStr,
+		Timeout:           seconds(timeouts.Timeout),
+		SetupTimeout:      seconds(timeouts.SetupTimeout),
+		MaxLifetime:       seconds(timeouts.MaxLifetime),
+		IdleTimeout:       seconds(timeouts.IdleTimeout),
+		Retries:           policy.Retries,
+		RetryOn:           strings.Join(policy.RetryOn, " "),
+		Attempt:           attempt,
 		InputDirectory:    lc.Input.Directory,
+		HostPrivateKey:    strings.TrimSpace(hostKey.PrivateKey),
+		HostPublicKey:     hostKey.PublicKey,
+		WaitForEnv:        waitForEnv,
+		EnvFile:           remoteEnvFile,
+	}
+
+	if checkpointInterval > 0 {
+		data.CheckpointPaths = strings.Join(lc.Checkpoint.Paths, " ")
+		data.CheckpointInterval = seconds(checkpointInterval)
+	}
+	if len(lc.Dependencies) > 0 {
+		data.Dependencies = FormatDependencies(lc.Dependencies)
 	}
+	if lc.Resume != nil {
+		data.RestoreJobID = lc.Resume.JobID
+		data.RunTimeOffset = lc.Resume.RunTime
+	}
+	return data, nil
+}
+
+func renderUserData(data UserData) (string, error) {
+	// Load the embeded user data template
+	tmpl := template.Must(template.New("user_data").Parse(userDataTemplate))
 
 	// Execute the template script with provided user data
 	var script bytes.Buffer
-	err = tmpl.Execute(&script, data)
+	err := tmpl.Execute(&script, data)
 	if err != nil {
 		return "", fmt.Errorf("Failed to execute user data script template: %w", err)
 	}
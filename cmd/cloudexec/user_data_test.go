@@ -6,6 +6,7 @@ import (
 	"testing"
 
 	"github.com/crytic/cloudexec/pkg/config"
+	"github.com/crytic/cloudexec/pkg/ssh"
 )
 
 func getLaunchConfig(duration string) LaunchConfig {
@@ -14,11 +15,7 @@ func getLaunchConfig(duration string) LaunchConfig {
 			Setup: "echo 'lets go'",
 			Run:   "echo 'lets run'",
 		},
-		Input: struct {
-			JobName   string
-			Directory string
-			Timeout   string
-		}{
+		Input: Input{
 			JobName:   "test job name",
 			Directory: "./input",
 			Timeout:   duration,
@@ -52,12 +49,17 @@ func TestUserDataGeneration(t *testing.T) {
 		{"It should parse a combination of time units", "1h2m3s", "3723"},
 	}
 
+	hostKey, err := ssh.GenerateHostKey()
+	if err != nil {
+		t.Fatalf("Failed to generate host key: %v", err)
+	}
+
 	for _, tt := range testTable {
 		t.Run(tt.name, func(t *testing.T) {
 
 			launchConfig := getLaunchConfig(tt.durationString)
 
-			result, err := GenerateUserData(config, launchConfig)
+			result, err := GenerateUserData(config, launchConfig, hostKey, false, 1)
 			if err != nil {
 				t.Errorf("Failed to generate user data: %v", err)
 			}
@@ -67,7 +69,33 @@ func TestUserDataGeneration(t *testing.T) {
 				t.Errorf("Expected result to contain substring %q, but it did not", substring)
 			}
 
+			if !strings.Contains(result, hostKey.PrivateKey) || !strings.Contains(result, hostKey.PublicKey) {
+				t.Errorf("Expected result to contain the pinned host key, but it did not")
+			}
+
 		})
 	}
 
 }
+
+func TestHostScriptGeneration(t *testing.T) {
+	config := config.Config{Username: "alice"}
+	config.DigitalOcean.ApiKey = "dop_v1_abc123"
+	config.DigitalOcean.SpacesAccessKey = "abc123"
+
+	result, err := GenerateHostScript(config, getLaunchConfig("1h"), 42, false)
+	if err != nil {
+		t.Fatalf("Failed to generate host script: %v", err)
+	}
+	for _, expected := range []string{`export JOB_ID="42"`, `export USERNAME="alice"`, `home="${HOME}/.cloudexec/jobs/job-42"`, "command tmux -L cloudexec", "cloudexec-42"} {
+		if !strings.Contains(result, expected) {
+			t.Errorf("Expected the host script to contain %q, but it did not", expected)
+		}
+	}
+	// The server must not be able to destroy droplets or be reconfigured by the script
+	for _, unexpected := range []string{"dop_v1_abc123", "systemd-run", "api.digitalocean.com", "/etc/ssh", "apt-get"} {
+		if strings.Contains(result, unexpected) {
+			t.Errorf("Expected the host script not to contain %q, but it did", unexpected)
+		}
+	}
+}
@@ -38,7 +38,7 @@
             pname = "cloudexec";
             version = "${version}";
             src = ./.;
-            vendorHash = "sha256-xiiMcjo+hRllttjYXB3F2Ms2gX43r7/qgwxr4THNhsk=";
+            vendorHash = "sha256-ps6S7eugqbv5JW1vH09fQeSsdKBW5FS7svLhGyZPhVs=";
             nativeBuildInputs = [
               pkgs.git
               pkgs.go_1_20
@@ -1,15 +1,38 @@
 package config
 
 import (
+	"bytes"
 	"fmt"
 	"os"
 	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
 
 	"github.com/BurntSushi/toml"
 
 	"github.com/crytic/cloudexec/pkg/log"
 )
 
+// Budget describes spending limits for droplets, zero values mean no limit
+type Budget struct {
+	MaxHourlyCost         float64 `toml:"maxHourlyCost,omitempty"`
+	MaxJobCost            float64 `toml:"maxJobCost,omitempty"`
+	MaxConcurrentDroplets int     `toml:"maxConcurrentDroplets,omitempty"`
+}
+
+// IsZero reports whether no spending limits are set
+func (b Budget) IsZero() bool {
+	return b == Budget{}
+}
+
+// SSH holds preferences for the SSH config entries that cloudexec adds for each job
+type SSH struct {
+	ForwardAgent bool `toml:"forwardAgent,omitempty"`
+	// Whether cloudexec may add an Include line for the entries of jobs to ~/.ssh/config
+	IncludeConfig bool `toml:"includeConfig,omitempty"`
+}
+
 type Config struct {
 	Username     string `toml:"username"`
 	DigitalOcean struct {
@@ -18,36 +41,132 @@ type Config struct {
 		SpacesSecretKey string `toml:"spacesSecretKey"`
 		SpacesRegion    string `toml:"spacesRegion"`
 	} `toml:"DigitalOcean"`
+	Budget Budget `toml:"Budget,omitempty"`
+	SSH    SSH    `toml:"SSH,omitempty"`
+	// Name of the profile that was loaded, empty for the default settings
+	Profile string `toml:"-"`
+}
+
+// DefaultPath returns where the config file is kept, $XDG_CONFIG_HOME/cloudexec/config.toml or
+// ~/.config/cloudexec/config.toml if XDG_CONFIG_HOME isn't set
+func DefaultPath() string {
+	configHome := os.Getenv("XDG_CONFIG_HOME")
+	if configHome == "" {
+		configHome = filepath.Join(os.Getenv("HOME"), ".config")
+	}
+	return filepath.Join(configHome, "cloudexec", "config.toml")
+}
+
+// ValidateProfileName checks that a profile name can be used in SSH host aliases and file names
+func ValidateProfileName(profile string) error {
+	if !profileName.MatchString(profile) {
+		return fmt.Errorf("Invalid profile name %q, only letters, digits, '-' and '_' are allowed", profile)
+	}
+	return nil
 }
 
-func Create(configValues Config) error {
-	configDir := filepath.Join(os.Getenv("HOME"), ".config", "cloudexec")
-	configFile := filepath.Join(configDir, "config.toml")
+var profileName = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// fileLayout is the layout of the config file, the top level settings are the default profile and each named
+// profile under [profiles.<name>] overrides some of them
+type fileLayout struct {
+	Config
+	Profiles map[string]toml.Primitive `toml:"profiles"`
+}
 
+// Save writes the given settings to the config file, either at the top level or under [profiles.<name>].
+// Settings that aren't given, like an empty budget, and any other profiles are left as they are in the file.
+func Save(configFilePath string, profile string, configValues Config) error {
+	// Edit the file as a generic document so unknown settings and other profiles survive
+	contents, err := readDocument(configFilePath)
+	if err != nil {
+		return err
+	}
+	var encoded bytes.Buffer
+	err = toml.NewEncoder(&encoded).Encode(configValues)
+	if err != nil {
+		return fmt.Errorf("Failed to encode configuration values: %w", err)
+	}
+	values := map[string]interface{}{}
+	_, err = toml.Decode(encoded.String(), &values)
+	if err != nil {
+		return fmt.Errorf("Failed to encode configuration values: %w", err)
+	}
+	section := profileSection(contents, profile)
+	for key, value := range values {
+		section[key] = value
+	}
+
+	err = writeDocument(configFilePath, contents)
+	if err != nil {
+		return err
+	}
+
+	if profile != "" {
+		log.Good("Configuration for profile %s saved to: %s", profile, configFilePath)
+	} else {
+		log.Good("Configuration file created at: %s", configFilePath)
+	}
+	return nil
+}
+
+// readDocument decodes the config file without interpreting it, a missing file is empty
+func readDocument(configFilePath string) (map[string]interface{}, error) {
+	contents := map[string]interface{}{}
+	_, err := toml.DecodeFile(configFilePath, &contents)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("Failed to decode configuration file: %w", err)
+	}
+	return contents, nil
+}
+
+// profileSection returns the table holding a profile's settings, creating it if needed.
+// The default profile's settings are at the top level.
+func profileSection(contents map[string]interface{}, profile string) map[string]interface{} {
+	if profile == "" {
+		return contents
+	}
+	return subTable(subTable(contents, "profiles"), profile)
+}
+
+// subTable returns the named table inside another one, creating it if needed
+func subTable(table map[string]interface{}, name string) map[string]interface{} {
+	sub, ok := table[name].(map[string]interface{})
+	if !ok {
+		sub = map[string]interface{}{}
+		table[name] = sub
+	}
+	return sub
+}
+
+// writeDocument replaces the config file, which is only readable by the user since it may hold credentials
+func writeDocument(configFilePath string, contents map[string]interface{}) error {
+	configDir := filepath.Dir(configFilePath)
 	err := os.MkdirAll(configDir, os.ModePerm)
 	if err != nil {
 		return fmt.Errorf("Failed to create configuration directory at %s: %w", configDir, err)
 	}
 
-	file, err := os.OpenFile(configFile, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	file, err := os.OpenFile(configFilePath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
 	if err != nil {
-		return fmt.Errorf("Failed to create configuration file at %s: %w", configFile, err)
+		return fmt.Errorf("Failed to create configuration file at %s: %w", configFilePath, err)
 	}
 	defer file.Close()
 
 	// Write the configuration values to the file
 	encoder := toml.NewEncoder(file)
-	err = encoder.Encode(configValues)
+	err = encoder.Encode(contents)
 	if err != nil {
 		return fmt.Errorf("Failed to encode configuration values: %w", err)
 	}
-
-	log.Good("Configuration file created at: %s", configFile)
 	return nil
 }
 
-func Load(configFilePath string) (Config, error) {
+// Load reads the config file, with the settings of the named profile applied on top of the default ones if a
+// profile is given. Credentials in environment variables take precedence over both.
+func Load(configFilePath string, profile string) (Config, error) {
 	var config Config
+	config.Profile = profile
 
 	// Any configuration value can be overridden by environment variables
 	// This is useful for CI/CD pipelines
@@ -73,11 +192,34 @@ func Load(configFilePath string) (Config, error) {
 	defer configFile.Close()
 
 	// Decode the configuration file
+	var contents fileLayout
 	decoder := toml.NewDecoder(configFile)
-	_, err = decoder.Decode(&config)
+	metadata, err := decoder.Decode(&contents)
 	if err != nil {
 		return config, fmt.Errorf("Failed to decode configuration file: %w", err)
 	}
+	config = contents.Config
+	config.Profile = profile
+
+	// Apply the profile's settings on top of the defaults
+	if profile != "" {
+		profileValues, ok := contents.Profiles[profile]
+		if !ok {
+			names := make([]string, 0, len(contents.Profiles))
+			for name := range contents.Profiles {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			if len(names) == 0 {
+				return config, fmt.Errorf("No profile named %s in %s, run 'cloudexec --profile %s configure' to create it", profile, configFilePath, profile)
+			}
+			return config, fmt.Errorf("No profile named %s in %s, the available profiles are: %s", profile, configFilePath, strings.Join(names, ", "))
+		}
+		err = metadata.PrimitiveDecode(profileValues, &config)
+		if err != nil {
+			return config, fmt.Errorf("Failed to decode profile %s: %w", profile, err)
+		}
+	}
 
 	// Override config values with environment variables if they are set
 	if doApiKey != "" {
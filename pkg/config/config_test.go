@@ -0,0 +1,165 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testConfig = `username = "alice"
+
+[DigitalOcean]
+  apiKey = "default-key"
+  spacesAccessKey = "default-access"
+  spacesSecretKey = "default-secret"
+  spacesRegion = "nyc3"
+
+[Budget]
+  maxJobCost = 10.0
+
+[profiles.work]
+  username = "alice-work"
+  [profiles.work.DigitalOcean]
+    apiKey = "work-key"
+    spacesRegion = "ams3"
+`
+
+func writeTestConfig(t *testing.T) string {
+	path := filepath.Join(t.TempDir(), "config.toml")
+	err := os.WriteFile(path, []byte(testConfig), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadProfile(t *testing.T) {
+	path := writeTestConfig(t)
+
+	defaults, err := Load(path, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if defaults.Username != "alice" || defaults.DigitalOcean.ApiKey != "default-key" {
+		t.Errorf("Unexpected default settings: %+v", defaults)
+	}
+
+	work, err := Load(path, "work")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if work.Profile != "work" || work.Username != "alice-work" || work.DigitalOcean.ApiKey != "work-key" || work.DigitalOcean.SpacesRegion != "ams3" {
+		t.Errorf("Profile settings were not applied: %+v", work)
+	}
+	// Settings the profile doesn't have are inherited
+	if work.DigitalOcean.SpacesSecretKey != "default-secret" || work.Budget.MaxJobCost != 10 {
+		t.Errorf("Default settings were not inherited: %+v", work)
+	}
+
+	_, err = Load(path, "personal")
+	if err == nil || !strings.Contains(err.Error(), "work") {
+		t.Errorf("Expected an error listing the available profiles, got %v", err)
+	}
+}
+
+func TestSaveKeepsOtherSettings(t *testing.T) {
+	path := writeTestConfig(t)
+
+	var personal Config
+	personal.Username = "alice-personal"
+	personal.DigitalOcean.ApiKey = "personal-key"
+	err := Save(path, "personal", personal)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var defaults Config
+	defaults.Username = "bob"
+	defaults.DigitalOcean.ApiKey = "new-key"
+	err = Save(path, "", defaults)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := Load(path, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Username != "bob" || loaded.DigitalOcean.ApiKey != "new-key" || loaded.Budget.MaxJobCost != 10 {
+		t.Errorf("Unexpected default settings after saving: %+v", loaded)
+	}
+	for profile, apiKey := range map[string]string{"work": "work-key", "personal": "personal-key"} {
+		loaded, err = Load(path, profile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if loaded.DigitalOcean.ApiKey != apiKey {
+			t.Errorf("Profile %s has API key %s, want %s", profile, loaded.DigitalOcean.ApiKey, apiKey)
+		}
+	}
+}
+
+func TestDefaultPath(t *testing.T) {
+	t.Setenv("HOME", "/home/alice")
+	t.Setenv("XDG_CONFIG_HOME", "")
+	if path := DefaultPath(); path != "/home/alice/.config/cloudexec/config.toml" {
+		t.Errorf("DefaultPath() = %s", path)
+	}
+	t.Setenv("XDG_CONFIG_HOME", "/xdg")
+	if path := DefaultPath(); path != "/xdg/cloudexec/config.toml" {
+		t.Errorf("DefaultPath() = %s", path)
+	}
+}
+
+func TestSetValue(t *testing.T) {
+	path := writeTestConfig(t)
+
+	err := SetValue(path, "", "budget.maxhourlycost", "1.5")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = SetValue(path, "work", "SSH.forwardAgent", "true")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = SetValue(path, "new", "username", "carol")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = SetValue(path, "", "Budget.maxConcurrentDroplets", "two"); err == nil {
+		t.Error("Expected an error setting a number to a word")
+	}
+	if err = SetValue(path, "", "DigitalOcean.token", "x"); err == nil {
+		t.Error("Expected an error setting an unknown key")
+	}
+
+	defaults, err := Load(path, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Other settings in the same table are kept
+	if defaults.Budget.MaxHourlyCost != 1.5 || defaults.Budget.MaxJobCost != 10 || defaults.SSH.ForwardAgent {
+		t.Errorf("Unexpected default settings: %+v", defaults)
+	}
+	work, err := Load(path, "work")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !work.SSH.ForwardAgent || work.DigitalOcean.ApiKey != "work-key" {
+		t.Errorf("Unexpected work settings: %+v", work)
+	}
+	setting, err := work.Get("ssh.FORWARDAGENT")
+	if err != nil || setting.Key != "SSH.forwardAgent" || setting.Value != "true" {
+		t.Errorf("Get() = %+v, %v", setting, err)
+	}
+	newProfile, err := Load(path, "new")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if newProfile.Username != "carol" || newProfile.DigitalOcean.ApiKey != "default-key" {
+		t.Errorf("Unexpected settings for the new profile: %+v", newProfile)
+	}
+	if len(newProfile.List()) != len(Keys()) {
+		t.Errorf("List() should return every setting")
+	}
+}
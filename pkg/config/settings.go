@@ -0,0 +1,142 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/crytic/cloudexec/pkg/log"
+)
+
+// setting is a value in the config file that can be read and written with 'cloudexec config'
+type setting struct {
+	key string
+	// Whether the value is a credential that shouldn't be printed unless asked for
+	secret bool
+	// field returns a pointer to the setting's field in the given config
+	field func(c *Config) interface{}
+}
+
+var settings = []setting{
+	{"username", false, func(c *Config) interface{} { return &c.Username }},
+	{"DigitalOcean.apiKey", true, func(c *Config) interface{} { return &c.DigitalOcean.ApiKey }},
+	{"DigitalOcean.spacesAccessKey", true, func(c *Config) interface{} { return &c.DigitalOcean.SpacesAccessKey }},
+	{"DigitalOcean.spacesSecretKey", true, func(c *Config) interface{} { return &c.DigitalOcean.SpacesSecretKey }},
+	{"DigitalOcean.spacesRegion", false, func(c *Config) interface{} { return &c.DigitalOcean.SpacesRegion }},
+	{"Budget.maxHourlyCost", false, func(c *Config) interface{} { return &c.Budget.MaxHourlyCost }},
+	{"Budget.maxJobCost", false, func(c *Config) interface{} { return &c.Budget.MaxJobCost }},
+	{"Budget.maxConcurrentDroplets", false, func(c *Config) interface{} { return &c.Budget.MaxConcurrentDroplets }},
+	{"SSH.forwardAgent", false, func(c *Config) interface{} { return &c.SSH.ForwardAgent }},
+	{"SSH.includeConfig", false, func(c *Config) interface{} { return &c.SSH.IncludeConfig }},
+}
+
+// Setting is the value of one of the settings in the config file
+type Setting struct {
+	Key    string `json:"key"`
+	Value  string `json:"value"`
+	Secret bool   `json:"secret"`
+}
+
+// Keys returns the names of the settings that can be read and written, eg DigitalOcean.apiKey
+func Keys() []string {
+	keys := make([]string, len(settings))
+	for i, s := range settings {
+		keys[i] = s.key
+	}
+	return keys
+}
+
+// lookupSetting finds a setting by its key, ignoring case like the config file decoder does
+func lookupSetting(key string) (setting, error) {
+	for _, s := range settings {
+		if strings.EqualFold(s.key, key) {
+			return s, nil
+		}
+	}
+	return setting{}, fmt.Errorf("Unknown setting %s, expected one of %s", key, strings.Join(Keys(), ", "))
+}
+
+// Get returns the value of a setting, eg Get("Budget.maxJobCost")
+func (c Config) Get(key string) (Setting, error) {
+	s, err := lookupSetting(key)
+	if err != nil {
+		return Setting{}, err
+	}
+	return Setting{
+		Key:    s.key,
+		Value:  fmt.Sprint(dereference(s.field(&c))),
+		Secret: s.secret,
+	}, nil
+}
+
+// List returns the values of all settings
+func (c Config) List() []Setting {
+	list := make([]Setting, len(settings))
+	for i, s := range settings {
+		list[i] = Setting{
+			Key:    s.key,
+			Value:  fmt.Sprint(dereference(s.field(&c))),
+			Secret: s.secret,
+		}
+	}
+	return list
+}
+
+// SetValue changes a single setting in the config file, at the top level or in the given profile.
+// The value is parsed according to the type of the setting, eg a number for budget limits.
+func SetValue(configFilePath string, profile string, key string, value string) error {
+	s, err := lookupSetting(key)
+	if err != nil {
+		return err
+	}
+	var parsed Config
+	switch field := s.field(&parsed).(type) {
+	case *string:
+		*field = value
+	case *float64:
+		*field, err = strconv.ParseFloat(value, 64)
+	case *int:
+		*field, err = strconv.Atoi(value)
+	case *bool:
+		*field, err = strconv.ParseBool(value)
+	}
+	if err != nil {
+		return fmt.Errorf("Invalid value for %s: %w", s.key, err)
+	}
+
+	contents, err := readDocument(configFilePath)
+	if err != nil {
+		return err
+	}
+	table := profileSection(contents, profile)
+	path := strings.Split(s.key, ".")
+	for _, name := range path[:len(path)-1] {
+		table = subTable(table, name)
+	}
+	table[path[len(path)-1]] = dereference(s.field(&parsed))
+	err = writeDocument(configFilePath, contents)
+	if err != nil {
+		return err
+	}
+	if profile != "" {
+		log.Good("Set %s for profile %s in %s", s.key, profile, configFilePath)
+	} else {
+		log.Good("Set %s in %s", s.key, configFilePath)
+	}
+	return nil
+}
+
+// dereference returns the value a setting's field points to
+func dereference(field interface{}) interface{} {
+	switch f := field.(type) {
+	case *string:
+		return *f
+	case *float64:
+		return *f
+	case *int:
+		return *f
+	case *bool:
+		return *f
+	}
+	return nil
+}
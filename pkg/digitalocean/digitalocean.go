@@ -15,12 +15,35 @@ import (
 )
 
 type Size struct {
+	Slug       string
 	CPUs       int64
 	Disk       int64
 	Memory     int64
 	HourlyCost float64
 }
 
+// SizeSpec describes a droplet size in DigitalOcean's catalogue
+type SizeSpec struct {
+	Size
+	MonthlyCost float64
+	Description string
+	Regions     []string
+	Available   bool
+}
+
+// AvailableIn returns true if droplets of this size can be created in the given region
+func (s SizeSpec) AvailableIn(region string) bool {
+	if !s.Available {
+		return false
+	}
+	for _, r := range s.Regions {
+		if r == region {
+			return true
+		}
+	}
+	return false
+}
+
 type Droplet struct {
 	Name    string
 	ID      int64
@@ -42,6 +65,8 @@ type Snapshot struct {
  * - GetAllDroplets(config config.Config) ([]Droplet, error)
  * - DeleteDroplet(config config.Config, dropletID int64) error
  * - GetLatestSnapshot(config config.Config) (Snapshot, error)
+ * - ListSizes(config config.Config) ([]SizeSpec, error)
+ * - GetSize(config config.Config, slug string) (SizeSpec, error)
  */
 
 var doClient *godo.Client
@@ -64,34 +89,26 @@ func initializeDOClient(accessToken string) (*godo.Client, error) {
 	return doClient, nil
 }
 
-func createSSHKeyOnDigitalOcean(keyName string, publicKey string) (string, error) {
+func createSSHKeyOnDigitalOcean(keyName string, publicKey string) (*godo.Key, error) {
 	createKeyRequest := &godo.KeyCreateRequest{
 		Name:      keyName,
 		PublicKey: publicKey,
 	}
+	log.Debug("DigitalOcean: creating SSH key %s", keyName)
 	key, _, err := doClient.Keys.Create(ctx, createKeyRequest)
 	if err != nil {
-		return "", fmt.Errorf("Failed to create SSH key on DigitalOcean: %w", err)
+		return nil, fmt.Errorf("Failed to create SSH key on DigitalOcean: %w", err)
 	}
-	return key.Fingerprint, nil
+	return key, nil
 }
 
-// Query DigitalOcean to see if a key with the given name exists, return it's fingerprint if so
-func findSSHKeyOnDigitalOcean(keyName string) (string, string, error) {
-	opt := &godo.ListOptions{
-		Page:    1,
-		PerPage: 200, // Maximum allowed by DigitalOcean
-	}
-	keys, _, err := doClient.Keys.List(context.Background(), opt)
+func deleteSSHKeyOnDigitalOcean(key *godo.Key) error {
+	log.Debug("DigitalOcean: deleting SSH key %s", key.Name)
+	_, err := doClient.Keys.DeleteByID(ctx, key.ID)
 	if err != nil {
-		return "", "", fmt.Errorf("Failed to list DigitalOcean SSH keys: %w", err)
+		return fmt.Errorf("Failed to delete SSH key %s from DigitalOcean: %w", key.Name, err)
 	}
-	for _, key := range keys {
-		if key.Name == keyName {
-			return key.Fingerprint, key.PublicKey, nil
-		}
-	}
-	return "", "", fmt.Errorf("SSH key with name '%s' not found", keyName)
+	return nil
 }
 
 ////////////////////////////////////////
@@ -105,6 +122,7 @@ func CheckAuth(config config.Config) error {
 		return err
 	}
 	// Check Account authentication
+	log.Debug("DigitalOcean: getting account")
 	_, _, err = doClient.Account.Get(context.Background())
 	if err != nil {
 		return fmt.Errorf("Failed to authenticate with DigitalOcean API: %w", err)
@@ -129,25 +147,20 @@ func CreateDroplet(config config.Config, region string, size string, userData st
 		return droplet, err
 	}
 
-	keyName := fmt.Sprintf("cloudexec-%v", config.Username)
-	sshKeyFingerprint, savedPublicKey, err := findSSHKeyOnDigitalOcean(keyName)
+	dropletName := fmt.Sprintf("cloudexec-%v-%v", config.Username, jobID)
 
-	dropletName := fmt.Sprintf("%s-%v", keyName, jobID)
-
-	if err == nil {
-		if publicKey != savedPublicKey {
-			return droplet, fmt.Errorf("Keys do not match! Consider removing your old key from DigitalOcean Security settings and re-running 'cloudexec launch'.")
-		}
-	} else {
-		// Create the SSH key on DigitalOcean
-		log.Wait("Saving SSH public key to DigitalOcean")
-		keyName := fmt.Sprintf("cloudexec-%v", config.Username)
-		sshKeyFingerprint, err = createSSHKeyOnDigitalOcean(keyName, publicKey)
+	// Each job has its own key which is only registered while the droplet is created,
+	// DigitalOcean installs it on the droplet so it's no longer needed on the account afterwards
+	sshKey, err := createSSHKeyOnDigitalOcean(dropletName, publicKey)
+	if err != nil {
+		return droplet, err
+	}
+	defer func() {
+		err := deleteSSHKeyOnDigitalOcean(sshKey)
 		if err != nil {
-			return droplet, fmt.Errorf("Failed to create SSH key on DigitalOcean: %w", err)
+			log.Warn("%v", err)
 		}
-		log.Good("SSH key is available on DigitalOcean with fingerprint: %v", sshKeyFingerprint)
-	}
+	}()
 
 	snap, err := GetLatestSnapshot(config)
 	if err != nil {
@@ -165,7 +178,7 @@ func CreateDroplet(config config.Config, region string, size string, userData st
 		UserData: userData,
 		SSHKeys: []godo.DropletCreateSSHKey{
 			{
-				Fingerprint: sshKeyFingerprint,
+				Fingerprint: sshKey.Fingerprint,
 			},
 		},
 		Tags: []string{
@@ -177,6 +190,7 @@ func CreateDroplet(config config.Config, region string, size string, userData st
 		WithDropletAgent: new(bool),
 	}
 
+	log.Debug("DigitalOcean: creating droplet %s of size %s in %s from image %s", dropletName, size, region, snap.ID)
 	newDroplet, resp, err := doClient.Droplets.Create(ctx, createRequest)
 	if err != nil {
 		return droplet, fmt.Errorf("Failed to create droplet: %w", err)
@@ -190,6 +204,7 @@ func CreateDroplet(config config.Config, region string, size string, userData st
 	}
 
 	if action != nil {
+		log.Debug("DigitalOcean: waiting for droplet %d to become active", newDroplet.ID)
 		_ = util.WaitForActive(ctx, doClient, action.HREF)
 		doDroplet, _, err := doClient.Droplets.Get(context.TODO(), newDroplet.ID)
 		if err != nil {
@@ -199,6 +214,7 @@ func CreateDroplet(config config.Config, region string, size string, userData st
 	}
 
 	droplet.Size = Size{
+		Slug:       newDroplet.SizeSlug,
 		CPUs:       int64(newDroplet.Vcpus),
 		Disk:       int64(newDroplet.Disk),
 		Memory:     int64(newDroplet.Memory),
@@ -222,6 +238,7 @@ func GetDropletById(config config.Config, id int64) (Droplet, error) {
 		return Droplet{}, err
 	}
 
+	log.Debug("DigitalOcean: getting droplet %d", id)
 	dropletInfo, _, err := doClient.Droplets.Get(context.TODO(), int(id))
 	if err != nil {
 		return Droplet{}, fmt.Errorf("Failed to get droplet by id: %v", err)
@@ -237,6 +254,7 @@ func GetDropletById(config config.Config, id int64) (Droplet, error) {
 		IP:      pubIp,
 		Created: dropletInfo.Created,
 		Size: Size{
+			Slug:       dropletInfo.SizeSlug,
 			CPUs:       int64(dropletInfo.Vcpus),
 			Disk:       int64(dropletInfo.Disk),
 			Memory:     int64(dropletInfo.Memory),
@@ -258,6 +276,7 @@ func GetAllDroplets(config config.Config) ([]Droplet, error) {
 	opts := &godo.ListOptions{}
 
 	for { // loop through all pages of the droplet list
+		log.Debug("DigitalOcean: listing droplets tagged %s (page %d)", targetTag, opts.Page)
 		myDroplets, resp, err := doClient.Droplets.ListByTag(ctx, targetTag, opts)
 		if err != nil {
 			return droplets, fmt.Errorf("Failed to fetch droplets by name: %w", err)
@@ -278,6 +297,7 @@ func GetAllDroplets(config config.Config) ([]Droplet, error) {
 					IP:      pubIp,
 					Created: droplet.Created,
 					Size: Size{
+						Slug:       droplet.SizeSlug,
 						CPUs:       int64(droplet.Vcpus),
 						Disk:       int64(droplet.Disk),
 						Memory:     int64(droplet.Memory),
@@ -309,6 +329,7 @@ func DeleteDroplet(config config.Config, dropletID int64) error {
 	if err != nil {
 		return err
 	}
+	log.Debug("DigitalOcean: deleting droplet %d", dropletID)
 	_, err = doClient.Droplets.Delete(context.Background(), int(dropletID))
 	if err != nil {
 		return fmt.Errorf("Failed to delete droplet: %w", err)
@@ -316,6 +337,66 @@ func DeleteDroplet(config config.Config, dropletID int64) error {
 	return nil
 }
 
+// ListSizes returns the catalogue of droplet sizes offered by DigitalOcean
+func ListSizes(config config.Config) ([]SizeSpec, error) {
+	var specs []SizeSpec
+	// create a client
+	doClient, err := initializeDOClient(config.DigitalOcean.ApiKey)
+	if err != nil {
+		return specs, err
+	}
+
+	options := &godo.ListOptions{
+		Page:    1,
+		PerPage: 200,
+	}
+
+	for { // loop through all pages of the size list
+		log.Debug("DigitalOcean: listing droplet sizes (page %d)", options.Page)
+		sizes, resp, err := doClient.Sizes.List(ctx, options)
+		if err != nil {
+			return specs, fmt.Errorf("Failed to list droplet sizes: %w", err)
+		}
+		for _, size := range sizes {
+			specs = append(specs, SizeSpec{
+				Size: Size{
+					Slug:       size.Slug,
+					CPUs:       int64(size.Vcpus),
+					Disk:       int64(size.Disk),
+					Memory:     int64(size.Memory),
+					HourlyCost: size.PriceHourly,
+				},
+				MonthlyCost: size.PriceMonthly,
+				Description: size.Description,
+				Regions:     size.Regions,
+				Available:   size.Available,
+			})
+		}
+
+		if resp.Links == nil || resp.Links.IsLastPage() {
+			break
+		}
+
+		options.Page++
+	}
+
+	return specs, nil
+}
+
+// GetSize looks up the specs and price of the droplet size with the given slug
+func GetSize(config config.Config, slug string) (SizeSpec, error) {
+	specs, err := ListSizes(config)
+	if err != nil {
+		return SizeSpec{}, err
+	}
+	for _, spec := range specs {
+		if spec.Slug == slug {
+			return spec, nil
+		}
+	}
+	return SizeSpec{}, fmt.Errorf("Droplet size %s does not exist, see 'cloudexec sizes' for available sizes", slug)
+}
+
 func GetLatestSnapshot(config config.Config) (Snapshot, error) {
 	empty := Snapshot{
 		ID:   "",
@@ -336,6 +417,7 @@ func GetLatestSnapshot(config config.Config) (Snapshot, error) {
 	}
 
 	for {
+		log.Debug("DigitalOcean: listing droplet snapshots (page %d)", options.Page)
 		snapshots, resp, err := doClient.Snapshots.ListDroplet(context.Background(), options)
 		if err != nil {
 			return empty, fmt.Errorf("Failed to list snapshots: %w", err)
@@ -1,7 +1,15 @@
 package log
 
 import (
+	"encoding/json"
 	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/term"
 )
 
 const (
@@ -11,29 +19,174 @@ const (
 	ColorBlue   = "\033[34m"
 	ColorYellow = "\033[33m"
 	ColorWhite  = "\033[37m"
+	ColorGray   = "\033[90m"
 )
 
-func Info(msg string, args ...interface{}) {
+// Level is the severity of a log message, messages below the configured level are dropped
+type Level int
+
+const (
+	DebugLevel Level = iota
+	InfoLevel
+	WarnLevel
+	ErrorLevel
+)
+
+// String returns the lowercase name of the level as used in JSON logs
+func (l Level) String() string {
+	switch l {
+	case DebugLevel:
+		return "debug"
+	case InfoLevel:
+		return "info"
+	case WarnLevel:
+		return "warn"
+	default:
+		return "error"
+	}
+}
+
+// Format is the encoding of log messages
+type Format string
+
+const (
+	TextFormat Format = "text"
+	JSONFormat Format = "json"
+)
+
+var (
+	// Guards the settings below and keeps concurrent messages from interleaving
+	mu sync.Mutex
+	// Logs go to stderr so that stdout is reserved for command results
+	output   io.Writer = os.Stderr
+	minLevel           = InfoLevel
+	format             = TextFormat
+	useColor           = shouldColor(os.Stderr)
+)
+
+// shouldColor returns true if colors should be used when writing to w.
+// Colors are disabled by the NO_COLOR convention, dumb terminals, and anything that isn't a terminal.
+func shouldColor(w io.Writer) bool {
+	if os.Getenv("NO_COLOR") != "" || os.Getenv("TERM") == "dumb" {
+		return false
+	}
+	file, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	return term.IsTerminal(int(file.Fd()))
+}
+
+// SetOutput changes where log messages are written, colors are re-detected for the new output
+func SetOutput(w io.Writer) {
+	mu.Lock()
+	defer mu.Unlock()
+	output = w
+	useColor = shouldColor(w)
+}
+
+// SetLevel drops all messages less severe than the given level
+func SetLevel(level Level) {
+	mu.Lock()
+	defer mu.Unlock()
+	minLevel = level
+}
+
+// IsDebug returns true if debug messages are being logged
+func IsDebug() bool {
+	mu.Lock()
+	defer mu.Unlock()
+	return minLevel <= DebugLevel
+}
+
+// SetFormat switches between human-readable text and one JSON object per line
+func SetFormat(newFormat Format) error {
+	if newFormat != TextFormat && newFormat != JSONFormat {
+		return fmt.Errorf("Unknown log format %s, expected one of %s, %s", newFormat, TextFormat, JSONFormat)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	format = newFormat
+	return nil
+}
+
+// write formats and outputs a single message if its level is enabled
+func write(level Level, color string, msg string, args ...interface{}) {
+	mu.Lock()
+	defer mu.Unlock()
+	if level < minLevel {
+		return
+	}
 	formatted := fmt.Sprintf(msg, args...)
-	fmt.Println(ColorWhite, formatted, ColorReset)
+	now := time.Now()
+
+	if format == JSONFormat {
+		writeJSON(now, level.String(), formatted)
+		return
+	}
+
+	// Timestamps are only noise during normal interactive use, so they're reserved for verbose output
+	if minLevel <= DebugLevel {
+		formatted = now.Format("15:04:05") + " " + formatted
+	}
+	if useColor {
+		formatted = color + formatted + ColorReset
+	}
+	fmt.Fprintln(output, formatted)
+}
+
+// writeJSON outputs a message as a single JSON object, the caller must hold mu
+func writeJSON(now time.Time, level string, msg string) {
+	entry, err := json.Marshal(struct {
+		Time    string `json:"time"`
+		Level   string `json:"level"`
+		Message string `json:"msg"`
+	}{
+		Time:    now.Format(time.RFC3339),
+		Level:   level,
+		Message: strings.TrimSpace(msg),
+	})
+	if err == nil {
+		fmt.Fprintln(output, string(entry))
+	}
+}
+
+func Debug(msg string, args ...interface{}) {
+	write(DebugLevel, ColorGray, msg, args...)
+}
+
+func Info(msg string, args ...interface{}) {
+	write(InfoLevel, ColorWhite, msg, args...)
 }
 
 func Wait(msg string, args ...interface{}) {
-	formatted := fmt.Sprintf(msg, args...) + "..."
-	fmt.Println(ColorBlue, formatted, ColorReset)
+	write(InfoLevel, ColorBlue, msg+"...", args...)
 }
 
 func Good(msg string, args ...interface{}) {
-	formatted := fmt.Sprintf(msg, args...)
-	fmt.Println(ColorGreen, formatted, ColorReset)
+	write(InfoLevel, ColorGreen, msg, args...)
 }
 
 func Warn(msg string, args ...interface{}) {
-	formatted := fmt.Sprintf(msg, args...)
-	fmt.Println(ColorYellow, formatted, ColorReset)
+	write(WarnLevel, ColorYellow, msg, args...)
 }
 
 func Error(msg string, args ...interface{}) {
+	write(ErrorLevel, ColorRed, msg, args...)
+}
+
+// Prompt asks the user for input, it's shown at every level because a hidden question would hang
+func Prompt(msg string, args ...interface{}) {
+	mu.Lock()
+	defer mu.Unlock()
 	formatted := fmt.Sprintf(msg, args...)
-	fmt.Println(ColorRed, formatted, ColorReset)
+	// JSON logs keep one object per line, with a level of its own so that prompts are easy to spot
+	if format == JSONFormat {
+		writeJSON(time.Now(), "prompt", formatted)
+		return
+	}
+	if useColor {
+		formatted = ColorYellow + formatted + ColorReset
+	}
+	fmt.Fprintln(output, formatted)
 }
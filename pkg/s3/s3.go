@@ -15,6 +15,7 @@ import (
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/s3"
 	"github.com/crytic/cloudexec/pkg/config"
+	"github.com/crytic/cloudexec/pkg/log"
 )
 
 /*
@@ -47,6 +48,7 @@ func initializeS3Client(config config.Config, init bool) (*s3.S3, error) {
 	} else {
 		spacesRegion = config.DigitalOcean.SpacesRegion
 	}
+	log.Debug("Creating Spaces client for endpoint %s in region %s", endpoint, spacesRegion)
 	// Configure the Spaces client
 	spacesConfig := &aws.Config{
 		Credentials:      credentials.NewStaticCredentials(spacesAccessKey, spacesSecretKey, ""),
@@ -75,6 +77,7 @@ func ListBuckets(config config.Config) ([]string, error) {
 		return buckets, err
 	}
 	// get bucket details from s3 provider
+	log.Debug("Spaces: listing buckets")
 	listBucketsOutput, err := s3Client.ListBuckets(&s3.ListBucketsInput{})
 	if err != nil {
 		return buckets, fmt.Errorf("Failed to list buckets: %w", err)
@@ -94,6 +97,7 @@ func SetVersioning(config config.Config) error {
 		return err
 	}
 	// ensure versioning is enabled on the bucket
+	log.Debug("Spaces: enabling versioning on bucket %s", bucketName)
 	_, err = s3Client.PutBucketVersioning(&s3.PutBucketVersioningInput{
 		Bucket: aws.String(bucketName),
 		VersioningConfiguration: &s3.VersioningConfiguration{
@@ -114,6 +118,7 @@ func CreateBucket(config config.Config) error {
 		return err
 	}
 	// execution bucket creation
+	log.Debug("Spaces: creating bucket %s", bucketName)
 	_, err = s3Client.CreateBucket(&s3.CreateBucketInput{
 		Bucket: aws.String(bucketName),
 	})
@@ -138,6 +143,7 @@ func PutObject(config config.Config, key string, value []byte) error {
 		return err
 	}
 	bucketName := fmt.Sprintf("cloudexec-%s", config.Username)
+	log.Debug("Spaces: putting object %s/%s (%d bytes)", bucketName, key, len(value))
 	// If zero-length value is given, create a directory instead of a file
 	if len(value) == 0 {
 		_, err = s3Client.PutObject(&s3.PutObjectInput{
@@ -176,6 +182,7 @@ func GetObject(config config.Config, key string) ([]byte, error) {
 	bucketName := fmt.Sprintf("cloudexec-%s", config.Username)
 	const maxRetries = 3
 	for i := 1; i <= maxRetries; i++ {
+		log.Debug("Spaces: getting object %s/%s (attempt %d)", bucketName, key, i)
 		resp, err := s3Client.GetObject(&s3.GetObjectInput{
 			Bucket: aws.String(bucketName),
 			Key:    aws.String(key),
@@ -232,6 +239,7 @@ func ListObjects(config config.Config, prefix string) ([]string, error) {
 		listObjectsInput.Prefix = aws.String(prefix)
 	}
 	for { // loop through all pages of the object list
+		log.Debug("Spaces: listing objects in bucket %s with prefix '%s'", bucketName, prefix)
 		listObjectsOutput, err := s3Client.ListObjects(listObjectsInput)
 		if err != nil {
 			return objects, fmt.Errorf("Failed to list objects in bucket '%s': %w", bucketName, err)
@@ -259,6 +267,27 @@ func ObjectExists(config config.Config, key string) (bool, error) {
 	return len(objects) != 0, nil
 }
 
+// CopyObject copies an object to another key in the same bucket, overwriting it if it exists
+func CopyObject(config config.Config, sourceKey string, destKey string) error {
+	bucketName := fmt.Sprintf("cloudexec-%s", config.Username)
+	// create a client
+	s3Client, err := initializeS3Client(config, false)
+	if err != nil {
+		return err
+	}
+	log.Debug("Spaces: copying object %s/%s to %s", bucketName, sourceKey, destKey)
+	_, err = s3Client.CopyObject(&s3.CopyObjectInput{
+		Bucket:     aws.String(bucketName),
+		CopySource: aws.String(fmt.Sprintf("%s/%s", bucketName, sourceKey)),
+		Key:        aws.String(destKey),
+		ACL:        aws.String("private"),
+	})
+	if err != nil {
+		return fmt.Errorf("Failed to copy object '%s' to '%s' in bucket '%s': %w", sourceKey, destKey, bucketName, err)
+	}
+	return nil
+}
+
 func DeleteObject(config config.Config, key string) error {
 	bucketName := fmt.Sprintf("cloudexec-%s", config.Username)
 	// create a client
@@ -270,6 +299,7 @@ func DeleteObject(config config.Config, key string) error {
 		Bucket: aws.String(bucketName),
 		Key:    aws.String(key),
 	}
+	log.Debug("Spaces: deleting object %s/%s", bucketName, key)
 	_, err = s3Client.DeleteObject(deleteObjectInput)
 	if err != nil {
 		return fmt.Errorf("Failed to delete object '%s' in bucket '%s': %w", key, bucketName, err)
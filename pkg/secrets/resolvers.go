@@ -0,0 +1,89 @@
+package secrets
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/zalando/go-keyring"
+)
+
+// resolveOp reads a 1password reference like op://vault/item/field with the op CLI
+func resolveOp(reference string) (string, error) {
+	output, err := runCommand("op", "read", "--no-newline", reference)
+	if err != nil {
+		return "", fmt.Errorf("Failed to process 1password reference for %s: %w", reference, err)
+	}
+	return strings.TrimSpace(output), nil
+}
+
+// resolveEnv reads a local environment variable, env://NAME
+func resolveEnv(reference string) (string, error) {
+	name := strings.TrimPrefix(reference, "env://")
+	value, ok := os.LookupEnv(name)
+	if !ok {
+		return "", fmt.Errorf("%s refers to the environment variable %s which is not set", reference, name)
+	}
+	return value, nil
+}
+
+// resolveFile reads the contents of a file, file:///absolute/path or file://~/path, without the trailing newline
+func resolveFile(reference string) (string, error) {
+	path := strings.TrimPrefix(reference, "file://")
+	if rest, ok := strings.CutPrefix(path, "~/"); ok {
+		homeDir, err := os.UserHomeDir()
+		if err != nil {
+			return "", fmt.Errorf("Failed to get home directory: %w", err)
+		}
+		path = filepath.Join(homeDir, rest)
+	}
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("Failed to read secret file for %s: %w", reference, err)
+	}
+	return strings.TrimRight(string(contents), "\r\n"), nil
+}
+
+// resolvePass reads an entry from the standard unix password manager, pass://path/to/entry.
+// Like `pass -c`, only the first line of the entry is used.
+func resolvePass(reference string) (string, error) {
+	output, err := runCommand("pass", "show", strings.TrimPrefix(reference, "pass://"))
+	if err != nil {
+		return "", fmt.Errorf("Failed to process pass reference for %s: %w", reference, err)
+	}
+	password, _, _ := strings.Cut(output, "\n")
+	return strings.TrimRight(password, "\r"), nil
+}
+
+// resolveKeyring reads a password from the OS keyring (macOS Keychain, Secret Service or Windows Credential
+// Manager), keyring://service/user
+func resolveKeyring(reference string) (string, error) {
+	service, user, found := strings.Cut(strings.TrimPrefix(reference, "keyring://"), "/")
+	if !found || service == "" || user == "" {
+		return "", fmt.Errorf("Keyring reference %s must look like keyring://service/user", reference)
+	}
+	secret, err := keyring.Get(service, user)
+	if err != nil {
+		return "", fmt.Errorf("Failed to read %s from the keyring: %w", reference, err)
+	}
+	return secret, nil
+}
+
+// runCommand runs a password manager's CLI and returns its output
+func runCommand(name string, args ...string) (string, error) {
+	var stderr bytes.Buffer
+	cmd := exec.Command(name, args...)
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	if err != nil {
+		// err just says "exit status 1" so prefer what the command printed
+		if message := strings.TrimSpace(stderr.String()); message != "" {
+			return "", fmt.Errorf("%s", message)
+		}
+		return "", err
+	}
+	return string(output), nil
+}
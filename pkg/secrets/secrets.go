@@ -0,0 +1,93 @@
+package secrets
+
+import (
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Resolver looks up the secret that a reference like op://vault/item/field points to
+type Resolver interface {
+	// Resolve is given the whole reference, including the scheme
+	Resolve(reference string) (string, error)
+}
+
+// ResolverFunc lets an ordinary function be used as a Resolver
+type ResolverFunc func(reference string) (string, error)
+
+func (f ResolverFunc) Resolve(reference string) (string, error) {
+	return f(reference)
+}
+
+var (
+	resolvers = map[string]Resolver{
+		"op":      ResolverFunc(resolveOp),
+		"env":     ResolverFunc(resolveEnv),
+		"file":    ResolverFunc(resolveFile),
+		"pass":    ResolverFunc(resolvePass),
+		"vault":   ResolverFunc(resolveVault),
+		"keyring": ResolverFunc(resolveKeyring),
+	}
+
+	// Resolved secrets are cached for the life of the process so that a command which needs the same secret
+	// several times, like a sweep or a launch of several named jobs, only asks the password manager once
+	cache      = map[string]string{}
+	cacheMutex sync.Mutex
+)
+
+// Register adds a resolver for references starting with <scheme>://, replacing any existing one
+func Register(scheme string, resolver Resolver) {
+	cacheMutex.Lock()
+	defer cacheMutex.Unlock()
+	resolvers[scheme] = resolver
+}
+
+// Schemes returns the reference schemes that can be resolved, sorted by name
+func Schemes() []string {
+	cacheMutex.Lock()
+	defer cacheMutex.Unlock()
+	schemes := make([]string, 0, len(resolvers))
+	for scheme := range resolvers {
+		schemes = append(schemes, scheme)
+	}
+	sort.Strings(schemes)
+	return schemes
+}
+
+// IsReference reports whether the value is a reference to a secret rather than the secret itself
+func IsReference(value string) bool {
+	cacheMutex.Lock()
+	defer cacheMutex.Unlock()
+	_, ok := lookupResolver(value)
+	return ok
+}
+
+// Resolve returns the secret that the value refers to, or the value itself if it isn't a reference
+func Resolve(value string) (string, error) {
+	cacheMutex.Lock()
+	defer cacheMutex.Unlock()
+	resolver, ok := lookupResolver(value)
+	if !ok {
+		return value, nil
+	}
+	if secret, ok := cache[value]; ok {
+		return secret, nil
+	}
+	// The lock is held while resolving so that concurrent lookups of the same reference don't both run the resolver
+	secret, err := resolver.Resolve(value)
+	if err != nil {
+		return "", err
+	}
+	cache[value] = secret
+	return secret, nil
+}
+
+// lookupResolver returns the resolver for the value's scheme, the cache mutex must be held
+func lookupResolver(value string) (Resolver, bool) {
+	scheme, _, found := strings.Cut(value, "://")
+	if !found {
+		return nil, false
+	}
+	resolver, ok := resolvers[scheme]
+	return resolver, ok
+}
@@ -0,0 +1,141 @@
+package secrets
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func resetCache() {
+	cacheMutex.Lock()
+	defer cacheMutex.Unlock()
+	cache = map[string]string{}
+}
+
+func TestResolvePlainValue(t *testing.T) {
+	for _, value := range []string{"dop_v1_abc", "", "https://example.com"} {
+		if IsReference(value) {
+			t.Errorf("%q should not be a reference", value)
+		}
+		resolved, err := Resolve(value)
+		if err != nil || resolved != value {
+			t.Errorf("Resolve(%q) = %q, %v, want the value unchanged", value, resolved, err)
+		}
+	}
+}
+
+func TestResolveEnv(t *testing.T) {
+	resetCache()
+	t.Setenv("CLOUDEXEC_TEST_SECRET", "hunter2")
+	value, err := Resolve("env://CLOUDEXEC_TEST_SECRET")
+	if err != nil || value != "hunter2" {
+		t.Fatalf("Resolve() = %q, %v, want hunter2", value, err)
+	}
+	if _, err := Resolve("env://CLOUDEXEC_TEST_UNSET"); err == nil {
+		t.Error("Expected an error for an unset env var")
+	}
+}
+
+func TestResolveFile(t *testing.T) {
+	resetCache()
+	path := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(path, []byte("s3cret\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	value, err := Resolve("file://" + path)
+	if err != nil || value != "s3cret" {
+		t.Fatalf("Resolve() = %q, %v, want s3cret", value, err)
+	}
+}
+
+func TestResolveCachesSecrets(t *testing.T) {
+	resetCache()
+	calls := 0
+	Register("counting", ResolverFunc(func(reference string) (string, error) {
+		calls++
+		return "value of " + reference, nil
+	}))
+	defer func() {
+		cacheMutex.Lock()
+		delete(resolvers, "counting")
+		cacheMutex.Unlock()
+	}()
+
+	for i := 0; i < 3; i++ {
+		value, err := Resolve("counting://a")
+		if err != nil || value != "value of counting://a" {
+			t.Fatalf("Resolve() = %q, %v", value, err)
+		}
+	}
+	if _, err := Resolve("counting://b"); err != nil {
+		t.Fatal(err)
+	}
+	if calls != 2 {
+		t.Errorf("Resolver was called %d times, want once per reference", calls)
+	}
+}
+
+// fakeVault serves the parts of the vault API that are used, with a version 2 engine mounted at secret/ and a
+// version 1 engine at kv/
+func fakeVault(t *testing.T) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != "root" {
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(`{"errors":["permission denied"]}`))
+			return
+		}
+		switch r.URL.Path {
+		case "/v1/sys/internal/ui/mounts/secret/app":
+			w.Write([]byte(`{"data":{"path":"secret/","options":{"version":"2"}}}`))
+		case "/v1/sys/internal/ui/mounts/kv/app":
+			w.Write([]byte(`{"data":{"path":"kv/","options":null}}`))
+		case "/v1/secret/data/app":
+			w.Write([]byte(`{"data":{"data":{"token":"v2-token"},"metadata":{"version":1}}}`))
+		case "/v1/kv/app":
+			w.Write([]byte(`{"data":{"token":"v1-token","port":8080}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"errors":[]}`))
+		}
+	}))
+}
+
+func TestResolveVault(t *testing.T) {
+	resetCache()
+	server := fakeVault(t)
+	defer server.Close()
+	t.Setenv("VAULT_ADDR", server.URL)
+	t.Setenv("VAULT_TOKEN", "root")
+
+	tests := map[string]string{
+		"vault://secret/app#token": "v2-token",
+		"vault://kv/app#token":     "v1-token",
+		"vault://kv/app#port":      "8080",
+	}
+	for reference, want := range tests {
+		value, err := Resolve(reference)
+		if err != nil || value != want {
+			t.Errorf("Resolve(%s) = %q, %v, want %q", reference, value, err, want)
+		}
+	}
+
+	for _, reference := range []string{"vault://secret/app#missing", "vault://secret/other#token", "vault://secret/app"} {
+		if _, err := Resolve(reference); err == nil {
+			t.Errorf("Expected an error resolving %s", reference)
+		}
+	}
+}
+
+func TestResolveVaultBadToken(t *testing.T) {
+	resetCache()
+	server := fakeVault(t)
+	defer server.Close()
+	t.Setenv("VAULT_ADDR", server.URL)
+	t.Setenv("VAULT_TOKEN", "wrong")
+
+	if _, err := Resolve("vault://secret/app#token"); err == nil {
+		t.Error("Expected an error with a bad token")
+	}
+}
@@ -0,0 +1,111 @@
+package secrets
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+var vaultClient = &http.Client{Timeout: 30 * time.Second}
+
+// resolveVault reads a field of a secret from a HashiCorp Vault KV secrets engine, vault://mount/path#field.
+// The path is the same one given to `vault kv get`, both version 1 and version 2 engines are supported.
+// The server and token are taken from VAULT_ADDR, VAULT_TOKEN (or ~/.vault-token) and VAULT_NAMESPACE like the vault CLI.
+func resolveVault(reference string) (string, error) {
+	path, field, found := strings.Cut(strings.TrimPrefix(reference, "vault://"), "#")
+	path = strings.Trim(path, "/")
+	if !found || path == "" || field == "" {
+		return "", fmt.Errorf("Vault reference %s must look like vault://mount/path#field", reference)
+	}
+
+	address := os.Getenv("VAULT_ADDR")
+	if address == "" {
+		address = "https://127.0.0.1:8200"
+	}
+	token, err := vaultToken()
+	if err != nil {
+		return "", err
+	}
+
+	// Version 2 engines nest secrets under <mount>/data/, ask vault which version the mount is
+	apiPath := path
+	var mount struct {
+		Data struct {
+			Path    string            `json:"path"`
+			Options map[string]string `json:"options"`
+		} `json:"data"`
+	}
+	err = vaultGet(address, token, "sys/internal/ui/mounts/"+path, &mount)
+	if err == nil && mount.Data.Options["version"] == "2" {
+		mountPath := strings.Trim(mount.Data.Path, "/")
+		apiPath = mountPath + "/data" + strings.TrimPrefix(path, mountPath)
+	}
+
+	var secret struct {
+		Data map[string]interface{} `json:"data"`
+	}
+	err = vaultGet(address, token, apiPath, &secret)
+	if err != nil {
+		return "", fmt.Errorf("Failed to read %s from vault: %w", reference, err)
+	}
+	data := secret.Data
+	if apiPath != path {
+		// Version 2 engines wrap the secret with its metadata
+		data, _ = secret.Data["data"].(map[string]interface{})
+	}
+	value, ok := data[field]
+	if !ok {
+		return "", fmt.Errorf("Vault secret %s has no field named %s", path, field)
+	}
+	if s, ok := value.(string); ok {
+		return s, nil
+	}
+	return fmt.Sprint(value), nil
+}
+
+// vaultToken returns the token the vault CLI would use
+func vaultToken() (string, error) {
+	if token := os.Getenv("VAULT_TOKEN"); token != "" {
+		return token, nil
+	}
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("Failed to get home directory: %w", err)
+	}
+	token, err := os.ReadFile(filepath.Join(homeDir, ".vault-token"))
+	if err != nil {
+		return "", fmt.Errorf("Set VAULT_TOKEN or log in with `vault login` to use vault references")
+	}
+	return strings.TrimSpace(string(token)), nil
+}
+
+// vaultGet makes a request to the vault HTTP API and decodes the JSON response
+func vaultGet(address, token, path string, response interface{}) error {
+	req, err := http.NewRequest(http.MethodGet, strings.TrimRight(address, "/")+"/v1/"+path, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("X-Vault-Token", token)
+	if namespace := os.Getenv("VAULT_NAMESPACE"); namespace != "" {
+		req.Header.Set("X-Vault-Namespace", namespace)
+	}
+	resp, err := vaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		var vaultErr struct {
+			Errors []string `json:"errors"`
+		}
+		if json.NewDecoder(resp.Body).Decode(&vaultErr) == nil && len(vaultErr.Errors) > 0 {
+			return fmt.Errorf("%s: %s", resp.Status, strings.Join(vaultErr.Errors, ", "))
+		}
+		return fmt.Errorf("%s", resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(response)
+}
@@ -0,0 +1,272 @@
+package ssh
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+
+	"github.com/crytic/cloudexec/pkg/log"
+)
+
+// How often an idle forwarding connection is checked, and how long the droplet has to answer
+const keepaliveInterval = 30 * time.Second
+const keepaliveTimeout = 15 * time.Second
+
+// How many warnings are kept while they're deferred, later ones are only counted
+const maxDeferredWarnings = 20
+
+// PortForward forwards a port on the local machine to a port on the droplet's loopback interface
+type PortForward struct {
+	LocalPort  int
+	RemotePort int
+}
+
+func (pf PortForward) String() string {
+	return fmt.Sprintf("%d:%d", pf.LocalPort, pf.RemotePort)
+}
+
+// ParsePortForward parses a '<local>:<remote>' spec, a single port forwards to the same port on the droplet
+func ParsePortForward(spec string) (PortForward, error) {
+	parsePort := func(port string) (int, error) {
+		value, err := strconv.Atoi(strings.TrimSpace(port))
+		if err != nil || value < 1 || value > 65535 {
+			return 0, fmt.Errorf("Invalid port %q in %q, expected <local>:<remote>", port, spec)
+		}
+		return value, nil
+	}
+	localPort, remotePort, hasRemote := strings.Cut(spec, ":")
+	local, err := parsePort(localPort)
+	if err != nil {
+		return PortForward{}, err
+	}
+	if !hasRemote {
+		return PortForward{LocalPort: local, RemotePort: local}, nil
+	}
+	remote, err := parsePort(remotePort)
+	if err != nil {
+		return PortForward{}, err
+	}
+	return PortForward{LocalPort: local, RemotePort: remote}, nil
+}
+
+// Forwarder relays local connections to the droplet, reconnecting over SSH whenever the connection drops
+type Forwarder struct {
+	target    Target
+	listeners []net.Listener
+	done      chan struct{}
+
+	mu     sync.Mutex
+	client *ssh.Client
+
+	// Warnings are held back while the terminal is attached to a remote session, since logging would garble it
+	warningsMu       sync.Mutex
+	deferWarnings    bool
+	deferredWarnings []string
+	droppedWarnings  int
+}
+
+// StartPortForwarding starts listening on the local ports and relaying connections until Close is called
+func StartPortForwarding(target Target, forwards []PortForward) (*Forwarder, error) {
+	forwarder := &Forwarder{
+		target: target,
+		done:   make(chan struct{}),
+	}
+	// Connect up front so a bad target is reported right away rather than on the first request
+	_, err := forwarder.getClient()
+	if err != nil {
+		return nil, err
+	}
+	for _, forward := range forwards {
+		// Only listen on loopback so the forwarded service isn't exposed to the local network
+		listener, err := net.Listen("tcp", net.JoinHostPort("localhost", strconv.Itoa(forward.LocalPort)))
+		if err != nil {
+			forwarder.Close()
+			return nil, fmt.Errorf("Failed to listen on local port %d: %w", forward.LocalPort, err)
+		}
+		forwarder.listeners = append(forwarder.listeners, listener)
+		go forwarder.serve(listener, forward)
+	}
+	go forwarder.keepalive()
+	return forwarder, nil
+}
+
+// Close stops listening and disconnects from the droplet
+func (f *Forwarder) Close() {
+	select {
+	case <-f.done:
+		return
+	default:
+		close(f.done)
+	}
+	for _, listener := range f.listeners {
+		listener.Close()
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.client != nil {
+		f.client.Close()
+		f.client = nil
+	}
+}
+
+// DeferWarnings holds back warnings until FlushWarnings is called, eg while the terminal is in raw mode
+func (f *Forwarder) DeferWarnings() {
+	f.warningsMu.Lock()
+	defer f.warningsMu.Unlock()
+	f.deferWarnings = true
+}
+
+// FlushWarnings logs the warnings held back since DeferWarnings was called and logs new ones right away again
+func (f *Forwarder) FlushWarnings() {
+	f.warningsMu.Lock()
+	defer f.warningsMu.Unlock()
+	for _, warning := range f.deferredWarnings {
+		log.Warn("%s", warning)
+	}
+	if f.droppedWarnings > 0 {
+		log.Warn("%d more port forwarding warnings were dropped", f.droppedWarnings)
+	}
+	f.deferWarnings = false
+	f.deferredWarnings = nil
+	f.droppedWarnings = 0
+}
+
+// warn logs a warning, or holds it back if warnings are deferred
+func (f *Forwarder) warn(format string, args ...interface{}) {
+	f.warningsMu.Lock()
+	defer f.warningsMu.Unlock()
+	if !f.deferWarnings {
+		log.Warn(format, args...)
+		return
+	}
+	if len(f.deferredWarnings) >= maxDeferredWarnings {
+		f.droppedWarnings++
+		return
+	}
+	f.deferredWarnings = append(f.deferredWarnings, fmt.Sprintf(format, args...))
+}
+
+// getClient returns the current SSH connection, reconnecting if the previous one was dropped
+func (f *Forwarder) getClient() (*ssh.Client, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.client != nil {
+		return f.client, nil
+	}
+	client, err := Dial(f.target)
+	if err != nil {
+		return nil, err
+	}
+	f.client = client
+	return client, nil
+}
+
+// dropClient forgets a broken SSH connection so that the next request reconnects
+func (f *Forwarder) dropClient(client *ssh.Client) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.client == client {
+		f.client.Close()
+		f.client = nil
+	}
+}
+
+// dialRemote opens a connection to a port on the droplet, retrying once over a fresh SSH connection
+func (f *Forwarder) dialRemote(port int) (net.Conn, error) {
+	address := net.JoinHostPort("localhost", strconv.Itoa(port))
+	var err error
+	for attempt := 1; attempt <= 2; attempt++ {
+		var client *ssh.Client
+		client, err = f.getClient()
+		if err != nil {
+			continue
+		}
+		var conn net.Conn
+		conn, err = client.Dial("tcp", address)
+		if err == nil {
+			return conn, nil
+		}
+		// The connection may have died since it was last used, or the remote port may just be closed
+		if _, _, pingErr := client.SendRequest("keepalive@openssh.com", true, nil); pingErr != nil {
+			f.warn("Lost connection to %s, reconnecting", HostAlias(f.target.JobID))
+			f.dropClient(client)
+			continue
+		}
+		break
+	}
+	return nil, err
+}
+
+// serve accepts local connections and relays each of them to the remote port
+func (f *Forwarder) serve(listener net.Listener, forward PortForward) {
+	for {
+		localConn, err := listener.Accept()
+		if err != nil {
+			select {
+			case <-f.done:
+			default:
+				f.warn("Stopped forwarding %s: %v", forward, err)
+			}
+			return
+		}
+		go func() {
+			defer localConn.Close()
+			remoteConn, err := f.dialRemote(forward.RemotePort)
+			if err != nil {
+				f.warn("Failed to forward connection to port %d on %s: %v", forward.RemotePort, HostAlias(f.target.JobID), err)
+				return
+			}
+			defer remoteConn.Close()
+			log.Debug("Forwarding connection from %s to port %d on %s", localConn.RemoteAddr(), forward.RemotePort, HostAlias(f.target.JobID))
+			// Close both sides as soon as either one is done
+			copyDone := make(chan struct{}, 2)
+			go func() {
+				_, _ = io.Copy(remoteConn, localConn)
+				copyDone <- struct{}{}
+			}()
+			go func() {
+				_, _ = io.Copy(localConn, remoteConn)
+				copyDone <- struct{}{}
+			}()
+			<-copyDone
+		}()
+	}
+}
+
+// keepalive periodically checks the SSH connection and reconnects if the droplet stopped answering
+func (f *Forwarder) keepalive() {
+	ticker := time.NewTicker(keepaliveInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-f.done:
+			return
+		case <-ticker.C:
+		}
+		client, err := f.getClient()
+		if err != nil {
+			f.warn("Failed to reconnect to %s, will retry: %v", HostAlias(f.target.JobID), err)
+			continue
+		}
+		reply := make(chan error, 1)
+		go func() {
+			_, _, err := client.SendRequest("keepalive@openssh.com", true, nil)
+			reply <- err
+		}()
+		select {
+		case err = <-reply:
+		case <-time.After(keepaliveTimeout):
+			err = fmt.Errorf("no reply after %v", keepaliveTimeout)
+		}
+		if err != nil {
+			f.warn("Lost connection to %s, reconnecting: %v", HostAlias(f.target.JobID), err)
+			f.dropClient(client)
+		}
+	}
+}
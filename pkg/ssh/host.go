@@ -0,0 +1,140 @@
+package ssh
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+
+	"github.com/crytic/cloudexec/pkg/log"
+)
+
+// Keys tried after the SSH agent's when connecting to an existing server, like OpenSSH does
+var defaultIdentityFiles = []string{"id_ed25519", "id_ecdsa", "id_rsa"}
+
+// getUserAuthMethods returns the user's own SSH credentials: the keys held by their SSH agent and any default
+// key files that aren't protected by a passphrase
+func getUserAuthMethods(sshDir string) []ssh.AuthMethod {
+	methods := []ssh.AuthMethod{}
+	if socket := os.Getenv("SSH_AUTH_SOCK"); socket != "" {
+		conn, err := net.Dial("unix", socket)
+		if err != nil {
+			log.Debug("Failed to connect to the SSH agent: %v", err)
+		} else {
+			methods = append(methods, ssh.PublicKeysCallback(agent.NewClient(conn).Signers))
+		}
+	}
+	signers := []ssh.Signer{}
+	for _, name := range defaultIdentityFiles {
+		keyBytes, err := os.ReadFile(filepath.Join(sshDir, name))
+		if err != nil {
+			continue
+		}
+		signer, err := ssh.ParsePrivateKey(keyBytes)
+		if err != nil {
+			log.Debug("Skipping %s: %v", name, err)
+			continue
+		}
+		signers = append(signers, signer)
+	}
+	if len(signers) > 0 {
+		methods = append(methods, ssh.PublicKeys(signers...))
+	}
+	return methods
+}
+
+// AuthorizeJobKey connects to an existing server with the user's own SSH credentials and authorizes the given job's
+// key on it, so the server can be reached like a droplet from then on. The server's identity is checked against
+// the user's known hosts file, and its ed25519 host key is returned to be pinned for the job.
+func AuthorizeJobKey(user string, address string, jobID int64, publicKey string) (HostKey, error) {
+	sshDir, err := getSSHDir()
+	if err != nil {
+		return HostKey{}, err
+	}
+	knownHostsFile := filepath.Join(sshDir, "known_hosts")
+	checkKnownHosts, err := knownhosts.New(knownHostsFile)
+	if err != nil {
+		return HostKey{}, fmt.Errorf("Failed to read known hosts file: %w", err)
+	}
+	methods := getUserAuthMethods(sshDir)
+	if len(methods) == 0 {
+		return HostKey{}, fmt.Errorf("No SSH agent or key without a passphrase was found to connect to %s with", address)
+	}
+
+	var hostKey ssh.PublicKey
+	config := &ssh.ClientConfig{
+		User:    user,
+		Auth:    methods,
+		Timeout: 30 * time.Second,
+		// Jobs pin an ed25519 host key, like the ones generated for droplets
+		HostKeyAlgorithms: []string{ssh.KeyAlgoED25519},
+		HostKeyCallback: func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+			err := checkKnownHosts(hostname, remote, key)
+			var keyErr *knownhosts.KeyError
+			if errors.As(err, &keyErr) {
+				return fmt.Errorf("The ed25519 host key of %s is not in %s, verify it by connecting with 'ssh -o HostKeyAlgorithms=ssh-ed25519 %s@%s' first", address, knownHostsFile, user, address)
+			}
+			if err != nil {
+				return err
+			}
+			hostKey = key
+			return nil
+		},
+	}
+	log.Debug("Connecting to %s@%s:22 with the user's SSH keys", user, address)
+	client, err := ssh.Dial("tcp", net.JoinHostPort(address, "22"), config)
+	if err != nil {
+		return HostKey{}, fmt.Errorf("Failed to connect to %s@%s: %w", user, address, err)
+	}
+	defer client.Close()
+	session, err := client.NewSession()
+	if err != nil {
+		return HostKey{}, fmt.Errorf("Failed to start SSH session: %w", err)
+	}
+	defer session.Close()
+
+	// Job IDs can be reused after a job is cleaned, so any key left over for this job is replaced
+	comment := HostAlias(jobID)
+	command := fmt.Sprintf(
+		"umask 077 && mkdir -p ~/.ssh && touch ~/.ssh/authorized_keys && sed -i '/ %s$/d' ~/.ssh/authorized_keys && echo '%s %s' >> ~/.ssh/authorized_keys",
+		comment, strings.TrimSpace(publicKey), comment,
+	)
+	output, err := session.CombinedOutput(command)
+	if err != nil {
+		return HostKey{}, fmt.Errorf("Failed to authorize the key of job %v on %s: %w: %s", jobID, address, err, strings.TrimSpace(string(output)))
+	}
+	log.Debug("Authorized the key of job %v on %s", jobID, address)
+
+	return HostKey{
+		PublicKey:   strings.TrimSpace(string(ssh.MarshalAuthorizedKey(hostKey))),
+		Fingerprint: ssh.FingerprintSHA256(hostKey),
+	}, nil
+}
+
+// RevokeJobKey removes a job's key from the authorized keys of the existing server it was authorized on, using the
+// key itself. The job script does this once it's done, so it's only needed if the script never started.
+func RevokeJobKey(target Target) error {
+	client, err := Dial(target)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+	session, err := client.NewSession()
+	if err != nil {
+		return fmt.Errorf("Failed to start SSH session: %w", err)
+	}
+	defer session.Close()
+	output, err := session.CombinedOutput(fmt.Sprintf("sed -i '/ %s$/d' ~/.ssh/authorized_keys", HostAlias(target.JobID)))
+	if err != nil {
+		return fmt.Errorf("Failed to revoke the key of job %v on %s: %w: %s", target.JobID, target.IPAddress, err, strings.TrimSpace(string(output)))
+	}
+	log.Debug("Revoked the key of job %v on %s", target.JobID, target.IPAddress)
+	return nil
+}
@@ -0,0 +1,197 @@
+package ssh
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/sftp"
+
+	"github.com/crytic/cloudexec/pkg/log"
+)
+
+// openSFTP connects to the target and starts an SFTP session, closing the returned function closes both
+func openSFTP(target Target) (*sftp.Client, func(), error) {
+	client, err := Dial(target)
+	if err != nil {
+		return nil, nil, err
+	}
+	sftpClient, err := sftp.NewClient(client)
+	if err != nil {
+		client.Close()
+		return nil, nil, fmt.Errorf("Failed to start SFTP session: %w", err)
+	}
+	return sftpClient, func() {
+		sftpClient.Close()
+		client.Close()
+	}, nil
+}
+
+// Upload copies a local file or directory to the given path on the target
+func Upload(target Target, localPath string, remotePath string) error {
+	sftpClient, closeSFTP, err := openSFTP(target)
+	if err != nil {
+		return err
+	}
+	defer closeSFTP()
+
+	info, err := os.Stat(localPath)
+	if err != nil {
+		return fmt.Errorf("Failed to read local path %s: %w", localPath, err)
+	}
+	// Like scp, copying into an existing remote directory keeps the local name
+	if remoteInfo, err := sftpClient.Stat(remotePath); err == nil && remoteInfo.IsDir() {
+		remotePath = path.Join(remotePath, filepath.Base(localPath))
+	}
+	if !info.IsDir() {
+		return uploadFile(sftpClient, localPath, remotePath, info.Mode())
+	}
+	return filepath.Walk(localPath, func(localFile string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		relPath, err := filepath.Rel(localPath, localFile)
+		if err != nil {
+			return err
+		}
+		remoteFile := path.Join(remotePath, filepath.ToSlash(relPath))
+		if info.IsDir() {
+			err = sftpClient.MkdirAll(remoteFile)
+			if err != nil {
+				return fmt.Errorf("Failed to create remote directory %s: %w", remoteFile, err)
+			}
+			return nil
+		}
+		return uploadFile(sftpClient, localFile, remoteFile, info.Mode())
+	})
+}
+
+func uploadFile(sftpClient *sftp.Client, localFile string, remoteFile string, mode os.FileMode) error {
+	log.Debug("Uploading %s to %s", localFile, remoteFile)
+	src, err := os.Open(localFile)
+	if err != nil {
+		return fmt.Errorf("Failed to open local file %s: %w", localFile, err)
+	}
+	defer src.Close()
+	dst, err := sftpClient.OpenFile(remoteFile, os.O_WRONLY|os.O_CREATE|os.O_TRUNC)
+	if err != nil {
+		return fmt.Errorf("Failed to create remote file %s: %w", remoteFile, err)
+	}
+	defer dst.Close()
+	_, err = io.Copy(dst, src)
+	if err != nil {
+		return fmt.Errorf("Failed to upload %s: %w", localFile, err)
+	}
+	// Keep the executable bit so uploaded scripts can be run
+	err = dst.Chmod(mode.Perm())
+	if err != nil {
+		return fmt.Errorf("Failed to set permissions of remote file %s: %w", remoteFile, err)
+	}
+	return nil
+}
+
+// Download copies a file or directory at the given path on the target to a local path
+func Download(target Target, remotePath string, localPath string) error {
+	sftpClient, closeSFTP, err := openSFTP(target)
+	if err != nil {
+		return err
+	}
+	defer closeSFTP()
+
+	info, err := sftpClient.Stat(remotePath)
+	if err != nil {
+		return fmt.Errorf("Failed to read remote path %s: %w", remotePath, err)
+	}
+	// Like scp, copying into an existing local directory keeps the remote name
+	if localInfo, err := os.Stat(localPath); err == nil && localInfo.IsDir() {
+		localPath = filepath.Join(localPath, path.Base(remotePath))
+	}
+	if !info.IsDir() {
+		return downloadFile(sftpClient, remotePath, localPath, info.Mode())
+	}
+	walker := sftpClient.Walk(remotePath)
+	for walker.Step() {
+		if walker.Err() != nil {
+			return fmt.Errorf("Failed to list remote directory %s: %w", remotePath, walker.Err())
+		}
+		remoteFile := walker.Path()
+		// Remote paths always use forward slashes, whatever the local OS
+		relPath := strings.TrimPrefix(strings.TrimPrefix(remoteFile, remotePath), "/")
+		localFile := filepath.Join(localPath, filepath.FromSlash(relPath))
+		if walker.Stat().IsDir() {
+			err := os.MkdirAll(localFile, 0755)
+			if err != nil {
+				return fmt.Errorf("Failed to create local directory %s: %w", localFile, err)
+			}
+			continue
+		}
+		err := downloadFile(sftpClient, remoteFile, localFile, walker.Stat().Mode())
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func downloadFile(sftpClient *sftp.Client, remoteFile string, localFile string, mode os.FileMode) error {
+	log.Debug("Downloading %s to %s", remoteFile, localFile)
+	src, err := sftpClient.Open(remoteFile)
+	if err != nil {
+		return fmt.Errorf("Failed to open remote file %s: %w", remoteFile, err)
+	}
+	defer src.Close()
+	dst, err := os.OpenFile(localFile, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode.Perm())
+	if err != nil {
+		return fmt.Errorf("Failed to create local file %s: %w", localFile, err)
+	}
+	defer dst.Close()
+	_, err = io.Copy(dst, src)
+	if err != nil {
+		return fmt.Errorf("Failed to download %s: %w", remoteFile, err)
+	}
+	return nil
+}
+
+// WriteFile creates or replaces a file on the target with the given contents, creating its directory if needed.
+// Only the path is logged since the contents may be sensitive.
+func WriteFile(target Target, remotePath string, data []byte, mode os.FileMode) error {
+	sftpClient, closeSFTP, err := openSFTP(target)
+	if err != nil {
+		return err
+	}
+	defer closeSFTP()
+
+	err = sftpClient.MkdirAll(path.Dir(remotePath))
+	if err != nil {
+		return fmt.Errorf("Failed to create remote directory %s: %w", path.Dir(remotePath), err)
+	}
+	log.Debug("Writing %s on %s", remotePath, HostAlias(target.JobID))
+	// Write to a temporary file first so the target never sees a partially written file
+	tmpPath := remotePath + ".tmp"
+	// Restrict permissions before writing anything so the contents are never readable by others
+	dst, err := sftpClient.OpenFile(tmpPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC)
+	if err != nil {
+		return fmt.Errorf("Failed to create remote file %s: %w", tmpPath, err)
+	}
+	defer dst.Close()
+	err = dst.Chmod(mode.Perm())
+	if err != nil {
+		return fmt.Errorf("Failed to set permissions of remote file %s: %w", tmpPath, err)
+	}
+	_, err = dst.Write(data)
+	if err != nil {
+		return fmt.Errorf("Failed to write remote file %s: %w", tmpPath, err)
+	}
+	err = dst.Close()
+	if err != nil {
+		return fmt.Errorf("Failed to write remote file %s: %w", tmpPath, err)
+	}
+	err = sftpClient.PosixRename(tmpPath, remotePath)
+	if err != nil {
+		return fmt.Errorf("Failed to move remote file into place at %s: %w", remotePath, err)
+	}
+	return nil
+}
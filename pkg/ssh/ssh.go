@@ -1,44 +1,73 @@
 package ssh
 
 import (
-	"bytes"
 	"crypto/ed25519"
 	"crypto/rand"
 	"encoding/pem"
+	"errors"
 	"fmt"
+	"net"
 	"os"
-	"os/exec"
 	"os/user"
 	"path/filepath"
 	"strings"
 	"text/template"
 	"time"
 
-	"github.com/kevinburke/ssh_config"
 	"github.com/mikesmitty/edkey"
 	"golang.org/x/crypto/ssh"
+	"golang.org/x/term"
 
 	"github.com/crytic/cloudexec/pkg/log"
 )
 
 const HostConfigTemplate = `
 # Added by cloudexec
-Host cloudexec-{{.JobID}}
+Host {{.HostAlias}}
   HostName {{.IPAddress}}
-  User root
-  IdentityFile {{.IdentityFile}}
+  User {{.User}}
+  IdentityFile "{{.IdentityFile}}"
   IdentitiesOnly yes
-  ForwardAgent yes
-  StrictHostKeyChecking no
-  UserKnownHostsFile=/dev/null
-  GlobalKnownHostsFile=/dev/null
+  ForwardAgent {{if .ForwardAgent}}yes{{else}}no{{end}}
+  HostKeyAlias {{.HostAlias}}
+  StrictHostKeyChecking yes
+  UserKnownHostsFile "{{.KnownHostsFile}}"
+  GlobalKnownHostsFile /dev/null
   Port 22
 `
 
 type HostConfig struct {
-	JobID        int64
-	IPAddress    string
-	IdentityFile string
+	HostAlias      string
+	IPAddress      string
+	User           string
+	IdentityFile   string
+	KnownHostsFile string
+	ForwardAgent   bool
+}
+
+// HostKey is an SSH host key generated locally and installed on a droplet while it boots
+type HostKey struct {
+	PrivateKey  string // OpenSSH PEM format
+	PublicKey   string // authorized_keys format
+	Fingerprint string // SHA256 fingerprint
+}
+
+// Prefix of the SSH host alias of each job, jobs of other profiles get their own prefix since their IDs overlap
+var hostPrefix = "cloudexec"
+
+// SetProfile namespaces the SSH host aliases and keys of jobs by the config profile they belong to.
+// The default profile keeps the plain cloudexec-<job id> aliases.
+func SetProfile(profile string) {
+	if profile == "" {
+		hostPrefix = "cloudexec"
+	} else {
+		hostPrefix = "cloudexec-" + profile
+	}
+}
+
+// HostAlias returns the name of a job's droplet in the SSH config, eg cloudexec-<job id>
+func HostAlias(jobID int64) string {
+	return fmt.Sprintf("%s-%v", hostPrefix, jobID)
 }
 
 func getSSHDir() (string, error) {
@@ -49,11 +78,88 @@ func getSSHDir() (string, error) {
 	return filepath.Join(user.HomeDir, ".ssh"), nil
 }
 
+// getKnownHostsFile returns the path to the file pinning the host key of a job's droplet
+func getKnownHostsFile(jobID int64) (string, error) {
+	sshDir, err := getSSHDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(sshDir, "cloudexec", HostAlias(jobID)+".known_hosts"), nil
+}
+
+// generateKeyPair creates a new ed25519 key pair encoded for use by OpenSSH
+func generateKeyPair() ([]byte, ssh.PublicKey, error) {
+	// Generate an ed25519 key pair
+	edPubKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Failed to generate SSH ed25519 key pair: %w", err)
+	}
+
+	// Encode the private key
+	privateKeyPEM := pem.EncodeToMemory(&pem.Block{
+		Type:  "OPENSSH PRIVATE KEY",
+		Bytes: edkey.MarshalED25519PrivateKey(privateKey),
+	})
+
+	// Convert the ed25519.PublicKey to ssh.PublicKey
+	publicKey, err := ssh.NewPublicKey(edPubKey)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Failed to create SSH public key: %w", err)
+	}
+	return privateKeyPEM, publicKey, nil
+}
+
+// GenerateHostKey creates a host key for a new droplet so that we know its identity before it boots
+func GenerateHostKey() (HostKey, error) {
+	privateKeyPEM, publicKey, err := generateKeyPair()
+	if err != nil {
+		return HostKey{}, err
+	}
+	return HostKey{
+		PrivateKey:  string(privateKeyPEM),
+		PublicKey:   strings.TrimSpace(string(ssh.MarshalAuthorizedKey(publicKey))),
+		Fingerprint: ssh.FingerprintSHA256(publicKey),
+	}, nil
+}
+
+// Line that makes OpenSSH read the host entries of jobs, relative to the SSH directory like in ~/.ssh/config
+const includeString = "Include cloudexec/config.d/*\n"
+
+// getConfigDir returns the directory holding the SSH config file of each job
+func getConfigDir() (string, error) {
+	sshDir, err := getSSHDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(sshDir, "cloudexec", "config.d"), nil
+}
+
+// getConfigFile returns the path to the SSH config file holding the host entry of a job
+func getConfigFile(jobID int64) (string, error) {
+	configDir, err := getConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(configDir, HostAlias(jobID)), nil
+}
+
+// isSSHConfigIncluded returns true if the $HOME/.ssh/config file imports the host entries of jobs
+func isSSHConfigIncluded() bool {
+	sshDir, err := getSSHDir()
+	if err != nil {
+		return false
+	}
+	content, err := os.ReadFile(filepath.Join(sshDir, "config"))
+	if err != nil {
+		return false
+	}
+	return strings.Contains(string(content), includeString)
+}
+
 // Verify that the $HOME/.ssh/config file imports everything from the config.d dir
 // We'll add/remove config for each server by adding/removing files in this dir
 func EnsureSSHIncludeConfig() error {
 	commentString := "# Added by cloudexec\n"
-	includeString := "Include config.d/*\n"
 	sshDir, err := getSSHDir()
 	if err != nil {
 		return err
@@ -93,54 +199,55 @@ func EnsureSSHIncludeConfig() error {
 	return nil
 }
 
-// Creates a new keypair that will be used to auth with all servers
-func GetOrCreateSSHKeyPair() (string, error) {
-	err := EnsureSSHIncludeConfig()
+// SSHCommand returns the OpenSSH command that connects to a job's server. The job's host entry is only picked up
+// by a plain 'ssh <host alias>' once the user's SSH config includes the entries of jobs.
+func SSHCommand(jobID int64) string {
+	hostname := HostAlias(jobID)
+	if isSSHConfigIncluded() {
+		return "ssh " + hostname
+	}
+	configPath, err := getConfigFile(jobID)
 	if err != nil {
-		return "", fmt.Errorf("Failed to validate SSH config: %w", err)
+		return "ssh " + hostname
 	}
+	return fmt.Sprintf("ssh -F %s %s", configPath, hostname)
+}
+
+// getJobIdentityFile returns the path to the private key used to auth with a job's droplet
+func getJobIdentityFile(jobID int64) (string, error) {
 	sshDir, err := getSSHDir()
 	if err != nil {
 		return "", err
 	}
+	return filepath.Join(sshDir, "cloudexec", HostAlias(jobID)+"-key"), nil
+}
 
-	privateKeyPath := filepath.Join(sshDir, "cloudexec-key")
-	publicKeyPath := filepath.Join(sshDir, "cloudexec-key.pub")
-
-	// Check if the key pair already exists
-	if _, err := os.Stat(privateKeyPath); err == nil {
-		// If the key pair exists, read and return the public key
-		publicKeyBytes, err := os.ReadFile(publicKeyPath)
-		if err != nil {
-			return "", fmt.Errorf("Failed to read SSH public key file: %w", err)
-		}
-		return string(publicKeyBytes), nil
+// CreateJobKeyPair creates a new keypair that is only used to auth with the droplet of the given job.
+// Any existing key for the job is replaced since job IDs can be reused after a job is cleaned.
+func CreateJobKeyPair(jobID int64) (string, error) {
+	privateKeyPath, err := getJobIdentityFile(jobID)
+	if err != nil {
+		return "", err
+	}
+	publicKeyPath := privateKeyPath + ".pub"
+	// Create the directory if it does not exist
+	err = os.MkdirAll(filepath.Dir(privateKeyPath), 0700)
+	if err != nil {
+		return "", fmt.Errorf("Failed to create SSH key directory: %w", err)
 	}
-	log.Wait("Creating new ssh keypair")
 
 	// Generate an ed25519 key pair
-	edPubKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	privateKeyPEM, publicKey, err := generateKeyPair()
 	if err != nil {
-		return "", fmt.Errorf("Failed to generate SSH ed25519 key pair: %w", err)
+		return "", err
 	}
 
-	// Encode and save the private key
-	privateKeyPEM := pem.EncodeToMemory(&pem.Block{
-		Type:  "OPENSSH PRIVATE KEY",
-		Bytes: edkey.MarshalED25519PrivateKey(privateKey),
-	})
-
+	// Save the private key
 	err = os.WriteFile(privateKeyPath, privateKeyPEM, 0600)
 	if err != nil {
 		return "", fmt.Errorf("Failed to save SSH private key file: %w", err)
 	}
 
-	// Convert the ed25519.PublicKey to ssh.PublicKey
-	publicKey, err := ssh.NewPublicKey(edPubKey)
-	if err != nil {
-		return "", fmt.Errorf("Failed to create SSH public key: %w", err)
-	}
-
 	// Save the public key
 	publicKeySSHFormat := ssh.MarshalAuthorizedKey(publicKey)
 	err = os.WriteFile(publicKeyPath, publicKeySSHFormat, 0644)
@@ -148,28 +255,56 @@ func GetOrCreateSSHKeyPair() (string, error) {
 		return "", fmt.Errorf("Failed to save SSH public key file: %w", err)
 	}
 
-	log.Good("Created new ssh keypair at %s(.pub)", privateKeyPath)
+	log.Debug("Created new ssh keypair for job %v at %s(.pub)", jobID, privateKeyPath)
 	return string(publicKeySSHFormat), nil
 }
 
-func AddSSHConfig(jobID int64, ipAddress string) error {
-	err := EnsureSSHIncludeConfig()
+// AddSSHConfig writes a host entry for the target to cloudexec's own SSH config directory so users can run
+// 'ssh <host alias>'. The user's main SSH config is only edited to include these entries if includeConfig is set,
+// otherwise the Include line is printed for them to add. The droplet's host key is pinned in a dedicated known
+// hosts file.
+func AddSSHConfig(target Target, hostPublicKey string, forwardAgent bool, includeConfig bool) error {
+	jobID := target.JobID
+	if includeConfig {
+		err := EnsureSSHIncludeConfig()
+		if err != nil {
+			return fmt.Errorf("Failed to validate main SSH config: %w", err)
+		}
+	} else if !isSSHConfigIncluded() {
+		log.Info("Add '%s' to the top of ~/.ssh/config to reach jobs with 'ssh <host alias>', or set SSH.includeConfig to true to have cloudexec add it", strings.TrimSpace(includeString))
+	}
+	configDir, err := getConfigDir()
+	if err != nil {
+		return err
+	}
+	hostname := HostAlias(jobID)
+	configPath, err := getConfigFile(jobID)
 	if err != nil {
-		return fmt.Errorf("Failed to validate main SSH config: %w", err)
+		return err
 	}
-	sshDir, err := getSSHDir()
+	identityFile, err := getIdentityFile(jobID)
+	if err != nil {
+		return err
+	}
+	knownHostsFile, err := getKnownHostsFile(jobID)
 	if err != nil {
 		return err
 	}
-	configDir := filepath.Join(sshDir, "config.d")
-	hostname := fmt.Sprintf("cloudexec-%v", jobID)
-	configPath := filepath.Join(configDir, hostname)
-	identityFile := filepath.Join(sshDir, "cloudexec-key")
-	// Create the SSH config directory if it does not exist
+	// Create the SSH config directories if they do not exist
 	err = os.MkdirAll(configDir, 0700)
 	if err != nil {
 		return fmt.Errorf("Failed to create SSH config directory: %w", err)
 	}
+	err = os.MkdirAll(filepath.Dir(knownHostsFile), 0700)
+	if err != nil {
+		return fmt.Errorf("Failed to create known hosts directory: %w", err)
+	}
+	// Pin the host key under the host alias so OpenSSH verifies the droplet's identity
+	knownHostsLine := fmt.Sprintf("%s %s\n", hostname, hostPublicKey)
+	err = os.WriteFile(knownHostsFile, []byte(knownHostsLine), 0600)
+	if err != nil {
+		return fmt.Errorf("Failed to write known hosts file: %w", err)
+	}
 	// If the config file does not exist, create it
 	configFile, err := os.Create(configPath)
 	if err != nil {
@@ -177,10 +312,17 @@ func AddSSHConfig(jobID int64, ipAddress string) error {
 	}
 	defer configFile.Close()
 	// Write the templated host config to file
+	user := target.User
+	if user == "" {
+		user = "root"
+	}
 	config := HostConfig{
-		JobID:        jobID,
-		IPAddress:    ipAddress,
-		IdentityFile: identityFile,
+		HostAlias:      hostname,
+		IPAddress:      target.IPAddress,
+		User:           user,
+		IdentityFile:   identityFile,
+		KnownHostsFile: knownHostsFile,
+		ForwardAgent:   forwardAgent,
 	}
 	tmpl, err := template.New("hostConfig").Parse(HostConfigTemplate)
 	if err != nil {
@@ -195,80 +337,155 @@ func AddSSHConfig(jobID int64, ipAddress string) error {
 }
 
 func DeleteSSHConfig(jobID int64) error {
-	err := EnsureSSHIncludeConfig()
+	sshDir, err := getSSHDir()
 	if err != nil {
-		return fmt.Errorf("Failed to validate SSH config: %w", err)
+		return err
 	}
-	sshDir, err := getSSHDir()
+	configPath, err := getConfigFile(jobID)
 	if err != nil {
 		return err
 	}
-	configDir := filepath.Join(sshDir, "config.d")
-	hostname := fmt.Sprintf("cloudexec-%v", jobID)
-	configPath := filepath.Join(configDir, hostname)
-	err = os.Remove(configPath)
-	if err != nil && !os.IsNotExist(err) {
-		return fmt.Errorf("unable to remove config file from config.d: %w", err)
+	hostname := HostAlias(jobID)
+	// Jobs launched by earlier versions have their host entry in ~/.ssh/config.d
+	for _, path := range []string{configPath, filepath.Join(sshDir, "config.d", hostname)} {
+		err = os.Remove(path)
+		if err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("unable to remove config file from config.d: %w", err)
+		}
+		// If there's no error, the file was deleted successfully
+		if err == nil {
+			log.Good("Deleted SSH config for %s", hostname)
+		}
 	}
-	// If there's no error, the file was deleted successfully
-	if err == nil {
-		log.Good("Deleted SSH config for cloudexec-%v", jobID)
+	// Forget the pinned host key as well
+	knownHostsFile, err := getKnownHostsFile(jobID)
+	if err != nil {
+		return err
 	}
-	return nil
-}
-
-func WaitForSSHConnection(jobID int64) error {
-	sshDir, err := getSSHDir()
+	err = os.Remove(knownHostsFile)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("unable to remove known hosts file: %w", err)
+	}
+	// And the job's keypair, which can't be used for anything else
+	identityFile, err := getJobIdentityFile(jobID)
 	if err != nil {
 		return err
 	}
-	hostname := fmt.Sprintf("cloudexec-%v", jobID)
-	hostname = strings.ReplaceAll(hostname, ".", "-")
-	sshConfigPath := filepath.Join(sshDir, "config.d", hostname)
+	for _, keyFile := range []string{identityFile, identityFile + ".pub"} {
+		err = os.Remove(keyFile)
+		if err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("unable to remove SSH key file: %w", err)
+		}
+	}
+	return nil
+}
 
-	timeout := 60 * time.Second
-	retryInterval := 10 * time.Second
+// Target describes how to reach a job's droplet over SSH
+type Target struct {
+	JobID     int64
+	IPAddress string
+	User      string
+	// SHA256 fingerprint of the droplet's pinned host key
+	HostKeyFingerprint string
+	// Name of the tmux socket the workload runs on, the default socket if empty
+	TmuxSocket string
+	// File the job script logs to, the cloud-init log if empty
+	LogFile string
+}
 
-	sshConfigBytes, err := os.ReadFile(sshConfigPath)
+// getIdentityFile returns the path to the private key used to auth with a job's droplet.
+// Jobs launched before keys were created per job use the key that was shared by all servers.
+func getIdentityFile(jobID int64) (string, error) {
+	identityFile, err := getJobIdentityFile(jobID)
 	if err != nil {
-		return fmt.Errorf("Failed to read SSH config file: %w", err)
+		return "", err
+	}
+	if _, err := os.Stat(identityFile); err == nil {
+		return identityFile, nil
 	}
-	// Decode the SSH config file into an io reader
-	sshConfig := bytes.NewReader(sshConfigBytes)
-	cfg, err := ssh_config.Decode(sshConfig)
+	sshDir, err := getSSHDir()
 	if err != nil {
-		return fmt.Errorf("Failed to load SSH config: %w", err)
+		return "", err
 	}
-	ipAddress, _ := cfg.Get(hostname, "HostName")
-	port, _ := cfg.Get(hostname, "Port")
-	user, _ := cfg.Get(hostname, "User")
-	identityFile, _ := cfg.Get(hostname, "IdentityFile")
-
-	// Encode the identity file to bytes for use with the SSH client
+	sharedIdentityFile := filepath.Join(sshDir, "cloudexec-key")
+	if _, err := os.Stat(sharedIdentityFile); err == nil {
+		return sharedIdentityFile, nil
+	}
+	return "", fmt.Errorf("No SSH key for job %v was found at %s, the job may have been launched from another machine", jobID, identityFile)
+}
 
+// getClientConfig builds the configuration used to connect to a target with the cloudexec key
+func getClientConfig(target Target, timeout time.Duration) (*ssh.ClientConfig, error) {
+	identityFile, err := getIdentityFile(target.JobID)
+	if err != nil {
+		return nil, err
+	}
 	identityFileBytes, err := os.ReadFile(identityFile)
 	if err != nil {
-		return fmt.Errorf("Failed to read identity file: %w", err)
+		return nil, fmt.Errorf("Failed to read identity file: %w", err)
 	}
-
 	// Parse the identity file bytes into an ssh.Signer
 	signer, err := ssh.ParsePrivateKey(identityFileBytes)
 	if err != nil {
-		return fmt.Errorf("Failed to parse private key: %w", err)
+		return nil, fmt.Errorf("Failed to parse private key: %w", err)
+	}
+	user := target.User
+	if user == "" {
+		user = "root"
 	}
-
 	config := &ssh.ClientConfig{
 		User: user,
 		Auth: []ssh.AuthMethod{
 			ssh.PublicKeys(signer),
 		},
-		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
-		Timeout:         retryInterval,
+		Timeout: timeout,
+	}
+	// Jobs launched before host keys were pinned can't be verified
+	if target.HostKeyFingerprint == "" {
+		log.Warn("Job %v has no pinned host key so the identity of its droplet can't be verified", target.JobID)
+		config.HostKeyCallback = ssh.InsecureIgnoreHostKey()
+		return config, nil
+	}
+	// Only accept the ed25519 host key that we generated and installed on the droplet
+	config.HostKeyAlgorithms = []string{ssh.KeyAlgoED25519}
+	config.HostKeyCallback = func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		fingerprint := ssh.FingerprintSHA256(key)
+		if fingerprint != target.HostKeyFingerprint {
+			return fmt.Errorf("Host key of %s does not match the key pinned for job %v: expected %s but got %s", remote, target.JobID, target.HostKeyFingerprint, fingerprint)
+		}
+		return nil
+	}
+	return config, nil
+}
+
+// Dial opens an SSH connection to the target, the caller is responsible for closing it
+func Dial(target Target) (*ssh.Client, error) {
+	config, err := getClientConfig(target, 30*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	log.Debug("Connecting to %s at %s:22", HostAlias(target.JobID), target.IPAddress)
+	client, err := ssh.Dial("tcp", net.JoinHostPort(target.IPAddress, "22"), config)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to connect to %s at %s: %w", HostAlias(target.JobID), target.IPAddress, err)
+	}
+	return client, nil
+}
+
+// WaitForSSHConnection retries connecting to a freshly created droplet until it accepts SSH connections
+func WaitForSSHConnection(target Target) error {
+	// Until the user data script installs our host key, the droplet will present a host key we reject
+	timeout := 180 * time.Second
+	retryInterval := 10 * time.Second
+
+	config, err := getClientConfig(target, retryInterval)
+	if err != nil {
+		return err
 	}
 
 	start := time.Now()
 	for {
-		conn, err := ssh.Dial("tcp", fmt.Sprintf("%s:%s", ipAddress, port), config)
+		conn, err := ssh.Dial("tcp", net.JoinHostPort(target.IPAddress, "22"), config)
 		if err == nil {
 			conn.Close()
 			return nil
@@ -279,36 +496,127 @@ func WaitForSSHConnection(jobID int64) error {
 			return fmt.Errorf("Timed out waiting for SSH connection: %w", err)
 		}
 
+		log.Debug("SSH connection to %s failed, retrying: %v", target.IPAddress, err)
 		time.Sleep(retryInterval)
 	}
 }
 
-func StreamLogs(jobID int64) error {
-	hostname := fmt.Sprintf("cloudexec-%v", jobID)
+// StreamLogs prints the droplet's provisioning logs as they're written until interrupted
+func StreamLogs(target Target) error {
+	client, err := Dial(target)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+	session, err := client.NewSession()
+	if err != nil {
+		return fmt.Errorf("Failed to start SSH session: %w", err)
+	}
+	defer session.Close()
 	// Stream the logs from the server with tail -f
-	sshCmd := exec.Command("ssh", hostname, "tail", "-f", "/var/log/cloud-init-output.log")
-	sshCmd.Stdout = os.Stdout
-	sshCmd.Stderr = os.Stderr
-	err := sshCmd.Run()
+	session.Stdout = os.Stdout
+	session.Stderr = os.Stderr
+	logFile := target.LogFile
+	if logFile == "" {
+		logFile = "/var/log/cloud-init-output.log"
+	}
+	err = session.Run("tail -f " + logFile)
 	if err != nil {
 		return fmt.Errorf("Failed to stream logs: %w", err)
 	}
 	return nil
 }
 
-func AttachToTmuxSession(jobID int64) error {
-	hostname := fmt.Sprintf("cloudexec-%v", jobID)
-	sshCmd := exec.Command("ssh", "-t", hostname, "tmux", "attach-session", "-t", "cloudexec")
+// AttachToTmuxSession connects the local terminal to the tmux session running the job's workload
+func AttachToTmuxSession(target Target) error {
+	client, err := Dial(target)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+	session, err := client.NewSession()
+	if err != nil {
+		return fmt.Errorf("Failed to start SSH session: %w", err)
+	}
+	defer session.Close()
 
-	// Connect the SSH command to the current terminal
-	sshCmd.Stdin = os.Stdin
-	sshCmd.Stdout = os.Stdout
-	sshCmd.Stderr = os.Stderr
+	// tmux needs a terminal, so mirror ours onto the remote end
+	stdinFd := int(os.Stdin.Fd())
+	stdoutFd := int(os.Stdout.Fd())
+	if !term.IsTerminal(stdinFd) || !term.IsTerminal(stdoutFd) {
+		return fmt.Errorf("Failed to attach to tmux session: stdin and stdout must be a terminal")
+	}
+	width, height, err := term.GetSize(stdoutFd)
+	if err != nil {
+		return fmt.Errorf("Failed to get terminal size: %w", err)
+	}
+	termType := os.Getenv("TERM")
+	if termType == "" {
+		termType = "xterm-256color"
+	}
+	modes := ssh.TerminalModes{
+		ssh.ECHO:          1,
+		ssh.TTY_OP_ISPEED: 14400,
+		ssh.TTY_OP_OSPEED: 14400,
+	}
+	err = session.RequestPty(termType, height, width, modes)
+	if err != nil {
+		return fmt.Errorf("Failed to request a remote terminal: %w", err)
+	}
 
-	// Run the SSH command
-	err := sshCmd.Run()
+	// Put our terminal in raw mode so keystrokes like ctrl-c are sent to tmux rather than handled locally
+	oldState, err := term.MakeRaw(stdinFd)
+	if err != nil {
+		return fmt.Errorf("Failed to put terminal into raw mode: %w", err)
+	}
+	defer func() {
+		_ = term.Restore(stdinFd, oldState)
+	}()
+
+	// Keep the remote terminal the same size as ours
+	stopWatching := watchWindowSize(stdoutFd, session)
+	defer stopWatching()
+
+	// Connect the SSH session to the current terminal
+	session.Stdin = os.Stdin
+	session.Stdout = os.Stdout
+	session.Stderr = os.Stderr
+
+	tmuxCommand := "tmux"
+	if target.TmuxSocket != "" {
+		tmuxCommand += " -L " + target.TmuxSocket
+	}
+	err = session.Run(tmuxCommand + " attach-session -t cloudexec")
 	if err != nil {
 		return fmt.Errorf("Failed to attach to tmux session: %w", err)
 	}
 	return nil
 }
+
+// RunCommand runs a command on the target with its output streamed to ours and returns the command's exit code
+func RunCommand(target Target, command string) (int, error) {
+	client, err := Dial(target)
+	if err != nil {
+		return 0, err
+	}
+	defer client.Close()
+	session, err := client.NewSession()
+	if err != nil {
+		return 0, fmt.Errorf("Failed to start SSH session: %w", err)
+	}
+	defer session.Close()
+	session.Stdin = os.Stdin
+	session.Stdout = os.Stdout
+	session.Stderr = os.Stderr
+	log.Debug("Running on %s: %s", HostAlias(target.JobID), command)
+	err = session.Run(command)
+	if err != nil {
+		// A command that ran but failed is reported through its exit code rather than as an error
+		var exitErr *ssh.ExitError
+		if errors.As(err, &exitErr) {
+			return exitErr.ExitStatus(), nil
+		}
+		return 0, fmt.Errorf("Failed to run command: %w", err)
+	}
+	return 0, nil
+}
@@ -0,0 +1,42 @@
+//go:build !windows
+
+package ssh
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/term"
+
+	"github.com/crytic/cloudexec/pkg/log"
+)
+
+// watchWindowSize forwards local terminal resizes to the remote session until the returned function is called
+func watchWindowSize(fd int, session *ssh.Session) func() {
+	resized := make(chan os.Signal, 1)
+	done := make(chan struct{})
+	signal.Notify(resized, syscall.SIGWINCH)
+	go func() {
+		for {
+			select {
+			case <-resized:
+				width, height, err := term.GetSize(fd)
+				if err != nil {
+					continue
+				}
+				err = session.WindowChange(height, width)
+				if err != nil {
+					log.Debug("Failed to resize remote terminal: %v", err)
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() {
+		signal.Stop(resized)
+		close(done)
+	}
+}
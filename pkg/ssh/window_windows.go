@@ -0,0 +1,42 @@
+//go:build windows
+
+package ssh
+
+import (
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/term"
+
+	"github.com/crytic/cloudexec/pkg/log"
+)
+
+// watchWindowSize forwards local terminal resizes to the remote session until the returned function is called.
+// Windows has no SIGWINCH so the terminal size is polled instead.
+func watchWindowSize(fd int, session *ssh.Session) func() {
+	done := make(chan struct{})
+	go func() {
+		lastWidth, lastHeight, _ := term.GetSize(fd)
+		ticker := time.NewTicker(500 * time.Millisecond)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				width, height, err := term.GetSize(fd)
+				if err != nil || (width == lastWidth && height == lastHeight) {
+					continue
+				}
+				lastWidth, lastHeight = width, height
+				err = session.WindowChange(height, width)
+				if err != nil {
+					log.Debug("Failed to resize remote terminal: %v", err)
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() {
+		close(done)
+	}
+}
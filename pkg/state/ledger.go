@@ -0,0 +1,79 @@
+package state
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/crytic/cloudexec/pkg/config"
+	"github.com/crytic/cloudexec/pkg/s3"
+)
+
+const ledgerKey = "state/ledger.json"
+
+// LedgerEntry is a snapshot of a job taken just before it was removed from the state file
+type LedgerEntry struct {
+	Owner      string `json:"owner"`
+	RecordedAt int64  `json:"recorded_at"` // Unix timestamp
+	Job        Job    `json:"job"`
+}
+
+// Ledger is an append-only history of jobs that outlives the state file
+type Ledger struct {
+	Entries []LedgerEntry `json:"entries"`
+}
+
+// GetLedger returns the job history ledger, which will be empty if nothing was ever recorded
+func GetLedger(config config.Config) (*Ledger, error) {
+	var ledger Ledger
+	// The ledger is created lazily so a missing object is not an error
+	exists, err := s3.ObjectExists(config, ledgerKey)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to check whether the ledger exists: %w", err)
+	}
+	if !exists {
+		return &ledger, nil
+	}
+	ledgerData, err := s3.GetObject(config, ledgerKey)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read ledger data: %w", err)
+	}
+	err = json.Unmarshal(ledgerData, &ledger)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to unmarshal ledger JSON: %w", err)
+	}
+	return &ledger, nil
+}
+
+// AppendToLedger records the given jobs at the end of the ledger, existing entries are never modified
+func AppendToLedger(config config.Config, jobs ...Job) error {
+	// TODO: Handle locking to prevent concurrent updates
+	ledger, err := GetLedger(config)
+	if err != nil {
+		return err
+	}
+	recordedAt := time.Now().Unix()
+	for _, job := range jobs {
+		ledger.Entries = append(ledger.Entries, LedgerEntry{
+			Owner:      config.Username,
+			RecordedAt: recordedAt,
+			Job:        job,
+		})
+	}
+	ledgerJSON, err := json.Marshal(ledger)
+	if err != nil {
+		return fmt.Errorf("Failed to marshal ledger to JSON: %w", err)
+	}
+	for i := 1; i <= maxRetries; i++ {
+		err = s3.PutObject(config, ledgerKey, ledgerJSON)
+		if err == nil {
+			break
+		}
+		if i < maxRetries {
+			time.Sleep(time.Duration(i) * time.Second)
+		} else {
+			return fmt.Errorf("Failed to update ledger after %d retries: %w", maxRetries, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,184 @@
+package state
+
+import (
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// JobStatuses lists every status a job can have
+var JobStatuses = []JobStatus{Provisioning, Running, Completed, Failed, Cancelled, Timedout}
+
+// IDRange is an inclusive range of job IDs, a single ID has the same first and last ID
+type IDRange struct {
+	First int64
+	Last  int64
+}
+
+// JobQuery selects jobs from the state, every criterion that is set must match
+type JobQuery struct {
+	// Job IDs to select, eg from '3,5-9'
+	IDs []IDRange
+	// Statuses to select, any of them matches
+	Statuses []JobStatus
+	// Shell-style glob matched against the job name, eg 'medusa*'
+	NamePattern string
+	// Only select jobs that were started at least this long ago
+	OlderThan time.Duration
+	// Labels that must all be set to the given values
+	Labels map[string]string
+	// Only select the jobs of this sweep
+	SweepID int64
+	// Only select the jobs of this pipeline
+	PipelineID int64
+	// Select every job, used when no other criteria are given
+	All bool
+}
+
+// IsEmpty returns true if no jobs were explicitly selected, callers then fall back to their own default
+func (q JobQuery) IsEmpty() bool {
+	return len(q.IDs) == 0 && len(q.Statuses) == 0 && q.NamePattern == "" && q.OlderThan == 0 && len(q.Labels) == 0 && q.SweepID == 0 && q.PipelineID == 0 && !q.All
+}
+
+// Matches returns true if the job satisfies every criterion of the query
+func (q JobQuery) Matches(job Job, now time.Time) bool {
+	if len(q.IDs) > 0 {
+		found := false
+		for _, ids := range q.IDs {
+			found = found || (ids.First <= job.ID && job.ID <= ids.Last)
+		}
+		if !found {
+			return false
+		}
+	}
+	if len(q.Statuses) > 0 {
+		found := false
+		for _, status := range q.Statuses {
+			found = found || status == job.Status
+		}
+		if !found {
+			return false
+		}
+	}
+	if q.NamePattern != "" {
+		// The pattern is validated when parsed so errors can be ignored here
+		matched, _ := path.Match(q.NamePattern, job.Name)
+		if !matched {
+			return false
+		}
+	}
+	if q.OlderThan > 0 && now.Sub(time.Unix(job.StartedAt, 0)) < q.OlderThan {
+		return false
+	}
+	if q.SweepID != 0 && job.SweepID != q.SweepID {
+		return false
+	}
+	if q.PipelineID != 0 && job.PipelineID != q.PipelineID {
+		return false
+	}
+	for key, value := range q.Labels {
+		jobValue, ok := job.Labels[key]
+		if !ok || jobValue != value {
+			return false
+		}
+	}
+	return true
+}
+
+// Query returns the jobs matching the query, in the order they appear in the state
+func (s *State) Query(q JobQuery) []Job {
+	now := time.Now()
+	jobs := []Job{}
+	for _, job := range s.Jobs {
+		if q.Matches(job, now) {
+			jobs = append(jobs, job)
+		}
+	}
+	return jobs
+}
+
+// ParseJobIDs parses a comma-separated list of job IDs and inclusive ranges, eg '3,5-9'
+func ParseJobIDs(spec string) ([]IDRange, error) {
+	var ids []IDRange
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		start, end, isRange := strings.Cut(part, "-")
+		first, err := strconv.ParseInt(start, 10, 64)
+		if err != nil || first < 1 {
+			return nil, fmt.Errorf("Invalid job ID %q in %q", start, spec)
+		}
+		last := first
+		if isRange {
+			last, err = strconv.ParseInt(end, 10, 64)
+			if err != nil || last < first {
+				return nil, fmt.Errorf("Invalid job ID range %q in %q", part, spec)
+			}
+		}
+		ids = append(ids, IDRange{First: first, Last: last})
+	}
+	if len(ids) == 0 {
+		return nil, fmt.Errorf("No job IDs in %q", spec)
+	}
+	return ids, nil
+}
+
+// ParseJobStatus returns the status with the given name
+func ParseJobStatus(name string) (JobStatus, error) {
+	for _, status := range JobStatuses {
+		if string(status) == strings.ToLower(name) {
+			return status, nil
+		}
+	}
+	names := make([]string, len(JobStatuses))
+	for i, status := range JobStatuses {
+		names[i] = string(status)
+	}
+	return "", fmt.Errorf("Unknown job status %s, expected one of %s", name, strings.Join(names, ", "))
+}
+
+// ParseAge parses a duration like time.ParseDuration but also accepts days and weeks, eg '7d' or '2w'
+func ParseAge(age string) (time.Duration, error) {
+	units := map[string]time.Duration{"d": 24 * time.Hour, "w": 7 * 24 * time.Hour}
+	for suffix, unit := range units {
+		if count, found := strings.CutSuffix(age, suffix); found {
+			value, err := strconv.ParseFloat(count, 64)
+			if err != nil || value < 0 {
+				return 0, fmt.Errorf("Invalid age %s, expected eg 12h, 7d or 2w", age)
+			}
+			return time.Duration(value * float64(unit)), nil
+		}
+	}
+	duration, err := time.ParseDuration(age)
+	if err != nil || duration < 0 {
+		return 0, fmt.Errorf("Invalid age %s, expected eg 12h, 7d or 2w", age)
+	}
+	return duration, nil
+}
+
+// ParseLabels parses a list of 'key=value' labels
+func ParseLabels(specs []string) (map[string]string, error) {
+	labels := make(map[string]string)
+	for _, spec := range specs {
+		key, value, found := strings.Cut(spec, "=")
+		key = strings.TrimSpace(key)
+		if !found || key == "" {
+			return nil, fmt.Errorf("Invalid label %q, expected key=value", spec)
+		}
+		labels[key] = strings.TrimSpace(value)
+	}
+	return labels, nil
+}
+
+// ValidateNamePattern checks that a job name pattern is a valid glob
+func ValidateNamePattern(pattern string) error {
+	_, err := path.Match(pattern, "")
+	if err != nil {
+		return fmt.Errorf("Invalid job name pattern %s: %w", pattern, err)
+	}
+	return nil
+}
@@ -0,0 +1,107 @@
+package state
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseJobIDs(t *testing.T) {
+	ids, err := ParseJobIDs("3,5-9")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(ids) != 2 || ids[0] != (IDRange{3, 3}) || ids[1] != (IDRange{5, 9}) {
+		t.Errorf("Unexpected job IDs: %+v", ids)
+	}
+	for _, spec := range []string{"", "abc", "0", "9-5", "3-"} {
+		if _, err := ParseJobIDs(spec); err == nil {
+			t.Errorf("Expected an error for %q but got none", spec)
+		}
+	}
+}
+
+func TestParseAge(t *testing.T) {
+	var testTable = []struct {
+		age       string
+		expected  time.Duration
+		expectErr bool
+	}{
+		{"12h", 12 * time.Hour, false},
+		{"7d", 7 * 24 * time.Hour, false},
+		{"2w", 14 * 24 * time.Hour, false},
+		{"1.5d", 36 * time.Hour, false},
+		{"d", 0, true},
+		{"-1d", 0, true},
+		{"soon", 0, true},
+	}
+	for _, tt := range testTable {
+		age, err := ParseAge(tt.age)
+		if tt.expectErr {
+			if err == nil {
+				t.Errorf("Expected an error for %q but got none", tt.age)
+			}
+			continue
+		}
+		if err != nil || age != tt.expected {
+			t.Errorf("Expected %v for %q, got %v (%v)", tt.expected, tt.age, age, err)
+		}
+	}
+}
+
+func TestQuery(t *testing.T) {
+	now := time.Now()
+	s := &State{Jobs: []Job{
+		{ID: 1, Name: "medusa-erc20", Status: Failed, StartedAt: now.Add(-10 * 24 * time.Hour).Unix(), Labels: map[string]string{"campaign": "q3"}, PipelineID: 1},
+		{ID: 2, Name: "echidna-erc20", Status: Failed, StartedAt: now.Add(-10 * 24 * time.Hour).Unix(), PipelineID: 1},
+		{ID: 3, Name: "medusa-vault", Status: Completed, StartedAt: now.Add(-1 * time.Hour).Unix(), Labels: map[string]string{"campaign": "q4"}, SweepID: 3},
+		{ID: 4, Name: "medusa-vault", Status: Running, StartedAt: now.Unix(), SweepID: 3},
+	}}
+
+	var testTable = []struct {
+		name     string
+		query    JobQuery
+		expected []int64
+	}{
+		{"It should select everything with all", JobQuery{All: true}, []int64{1, 2, 3, 4}},
+		{"It should select ID ranges", JobQuery{IDs: []IDRange{{1, 1}, {3, 4}}}, []int64{1, 3, 4}},
+		{"It should select by status", JobQuery{Statuses: []JobStatus{Failed, Running}}, []int64{1, 2, 4}},
+		{"It should select by name pattern", JobQuery{NamePattern: "medusa*"}, []int64{1, 3, 4}},
+		{"It should select by age", JobQuery{OlderThan: 7 * 24 * time.Hour}, []int64{1, 2}},
+		{"It should select by label", JobQuery{Labels: map[string]string{"campaign": "q4"}}, []int64{3}},
+		{"It should select by sweep", JobQuery{SweepID: 3}, []int64{3, 4}},
+		{"It should select by pipeline", JobQuery{PipelineID: 1}, []int64{1, 2}},
+		{"It should combine criteria", JobQuery{NamePattern: "medusa*", Statuses: []JobStatus{Failed}}, []int64{1}},
+	}
+	for _, tt := range testTable {
+		t.Run(tt.name, func(t *testing.T) {
+			jobs := s.Query(tt.query)
+			ids := []int64{}
+			for _, job := range jobs {
+				ids = append(ids, job.ID)
+			}
+			if len(ids) != len(tt.expected) {
+				t.Fatalf("Expected jobs %v, got %v", tt.expected, ids)
+			}
+			for i := range ids {
+				if ids[i] != tt.expected[i] {
+					t.Fatalf("Expected jobs %v, got %v", tt.expected, ids)
+				}
+			}
+		})
+	}
+}
+
+func TestParseLabels(t *testing.T) {
+	labels, err := ParseLabels([]string{"campaign=q4", "commit = abc", "empty="})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(labels) != 3 || labels["campaign"] != "q4" || labels["commit"] != "abc" || labels["empty"] != "" {
+		t.Errorf("Unexpected labels: %v", labels)
+	}
+	for _, spec := range []string{"campaign", "=q4"} {
+		if _, err := ParseLabels([]string{spec}); err == nil {
+			t.Errorf("Expected an error for %q but got none", spec)
+		}
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"sync"
 	"time"
 
 	"github.com/crytic/cloudexec/pkg/config"
@@ -26,6 +27,7 @@ const (
 
 type Job struct {
 	Name        string    `json:"name"`
+	Project     string    `json:"project,omitempty"`
 	ID          int64     `json:"id"`
 	StartedAt   int64     `json:"started_at"` // Unix timestamp
 	CompletedAt int64     `json:"completed_at"`
@@ -33,6 +35,66 @@ type Job struct {
 	Status      JobStatus `json:"status"`
 	Delete      bool
 	Droplet     do.Droplet `json:"droplet"`
+	// SHA256 fingerprint of the host key installed on the droplet
+	HostKeyFingerprint string `json:"host_key_fingerprint,omitempty"`
+	// Ports forwarded automatically on attach, as '<local>:<remote>'
+	Ports []string `json:"ports,omitempty"`
+	// Free-form key=value metadata from the launch config and the command line
+	Labels map[string]string `json:"labels,omitempty"`
+	// Revision of the input directory, if it's in a git repository
+	Git *GitInfo `json:"git,omitempty"`
+	// Local user and machine the job was launched from
+	LaunchedBy string `json:"launched_by,omitempty"`
+	Hostname   string `json:"hostname,omitempty"`
+	// ID of the sweep this job was launched in, which is the ID of the sweep's first job
+	SweepID int64 `json:"sweep_id,omitempty"`
+	// Values of the matrix variables this job was launched with
+	Matrix map[string]string `json:"matrix,omitempty"`
+	// Name of the [jobs.<name>] section of the launch config this job was launched from
+	ConfigName string `json:"config_name,omitempty"`
+	// Unix time at which the run command times out, set by the droplet once it starts running and by extend
+	Deadline int64 `json:"deadline,omitempty"`
+	// How many times the job may be retried, from the launch config
+	Retries int `json:"retries,omitempty"`
+	// Number of the current attempt, counting from 1, zero if the job was never retried
+	Attempt int `json:"attempt,omitempty"`
+	// Earlier attempts of this job that failed and were retried
+	Attempts []Attempt `json:"attempts,omitempty"`
+	// Latest snapshot of the job's checkpoint paths in the bucket
+	Checkpoint *Checkpoint `json:"checkpoint,omitempty"`
+	// ID of the job whose checkpoint this job was resumed from
+	ResumedFrom int64 `json:"resumed_from,omitempty"`
+	// ID of the pipeline this job was launched by, which is the ID of the pipeline's first job
+	PipelineID int64 `json:"pipeline_id,omitempty"`
+	// Jobs whose output this job was given as input, by the name of their [jobs.<name>] section
+	DependsOn map[string]int64 `json:"depends_on,omitempty"`
+	// Whether the droplet failed to upload the output or logs of a job stopped with 'cloudexec stop'
+	UploadFailed bool `json:"upload_failed,omitempty"`
+	// user@address of the existing server the job runs on, if it wasn't given a droplet of its own
+	Host string `json:"host,omitempty"`
+}
+
+// Checkpoint describes the latest checkpoint of a job, stored at job-<id>/checkpoint.tar.gz in the bucket
+type Checkpoint struct {
+	CreatedAt int64 `json:"created_at"`
+	// Seconds the run command had run for when the checkpoint was taken, including any jobs it was resumed from
+	RunTime int64 `json:"run_time"`
+}
+
+// Attempt is a failed attempt at running a job
+type Attempt struct {
+	Number    int    `json:"number"`
+	Reason    string `json:"reason"` // eg setup-failure or exit-code:1
+	StartedAt int64  `json:"started_at"`
+	EndedAt   int64  `json:"ended_at"`
+}
+
+// GitInfo describes the git revision of a job's input directory at launch
+type GitInfo struct {
+	Commit string `json:"commit"`
+	Branch string `json:"branch"`
+	// True if there were uncommitted changes
+	Dirty bool `json:"dirty"`
 }
 
 type State struct {
@@ -104,8 +166,13 @@ func MergeStates(existingState, newState *State) {
 	newState.Jobs = removeDeletedJobs(newState.Jobs, deletedJobs)
 }
 
+// Serializes updates from jobs launched in parallel, other processes can still race with us
+var saveMutex sync.Mutex
+
 func MergeAndSave(config config.Config, newState *State) error {
 	// TODO: Handle locking to prevent concurrent updates
+	saveMutex.Lock()
+	defer saveMutex.Unlock()
 	stateKey := "state/state.json"
 	existingState, err := GetState(config)
 	if err != nil {
@@ -132,26 +199,45 @@ func MergeAndSave(config config.Config, newState *State) error {
 	return nil
 }
 
+////////////////////////////////////////
+// Job Methods
+
+// Runtime returns the number of seconds between the job's start and its last update
+func (j *Job) Runtime() int64 {
+	latestUpdate := j.CompletedAt
+	if latestUpdate == 0 {
+		latestUpdate = j.UpdatedAt
+	}
+	return latestUpdate - j.StartedAt
+}
+
+// Cost returns the dollars spent on the job's droplet so far
+func (j *Job) Cost() float64 {
+	return float64(j.Runtime()) / float64(3600) * j.Droplet.Size.HourlyCost
+}
+
+// IsFinished returns true if the job has stopped running for any reason
+func (j *Job) IsFinished() bool {
+	return j.Status != Provisioning && j.Status != Running
+}
+
 ////////////////////////////////////////
 // State Methods
 
+// CancelRunningJob marks a running job as cancelled. Only that job is saved, so that jobs changed or removed
+// since this state was loaded are left as they are.
 func (s *State) CancelRunningJob(config config.Config, jobID int64) error {
-	// Mark any running jobs as cancelled
 	for i, job := range s.Jobs {
-		if job.ID == jobID {
-			if job.Status == Running || job.Status == Provisioning {
-				s.Jobs[i].Status = Cancelled
-				break
-			} else {
-				return fmt.Errorf("Job %v is not running", jobID)
-			}
+		if job.ID != jobID {
+			continue
 		}
+		if job.Status != Running && job.Status != Provisioning {
+			return fmt.Errorf("Job %v is not running", jobID)
+		}
+		s.Jobs[i].Status = Cancelled
+		return MergeAndSave(config, &State{Jobs: []Job{s.Jobs[i]}})
 	}
-	err := MergeAndSave(config, s)
-	if err != nil {
-		return err
-	}
-	return nil
+	return fmt.Errorf("Job %v does not exist", jobID)
 }
 
 // GetJob returns a job with the specified ID or nil if not found.